@@ -0,0 +1,745 @@
+package fold
+
+import (
+	. "../quadedge"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+/* Folding a flat net into a solid.
+
+   A net is a set of polygons joined at hinges.  Folding it glues each
+   edge around the boundary of the net to another boundary edge of the
+   same length.  There are two steps:
+
+   1. Find which boundary edges are glued together.  Where two glued
+   edges meet at a vertex of the boundary, the angle of the net there is
+   the whole angle around that vertex of the solid, so it must be less
+   than 360 degrees.  Gluing the two edges zips them up, joining the
+   vertices at their other ends, and zipping carries on from there until
+   the whole boundary is glued.  There is often more than one way to do
+   this, so each is tried in turn until one folds.
+
+   2. Find positions in 3D for the vertices of the solid, such that
+   every polygon keeps its shape.  The positions start from a guess
+   based on distances across the net (classical multidimensional
+   scaling), and are then relaxed by moving pairs of vertices closer
+   together or further apart until every polygon has the right shape.
+   If the relaxation doesn't settle, the gluing was the wrong one.
+
+   Only convex solids are found.
+*/
+
+type Point3D struct {
+	X, Y, Z float64
+}
+
+// Add returns a + b.
+func (a Point3D) Add(b Point3D) Point3D {
+	return Point3D{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
+}
+
+// Sub returns a - b.
+func (a Point3D) Sub(b Point3D) Point3D {
+	return Point3D{a.X - b.X, a.Y - b.Y, a.Z - b.Z}
+}
+
+// Scale returns a times s.
+func (a Point3D) Scale(s float64) Point3D {
+	return Point3D{a.X * s, a.Y * s, a.Z * s}
+}
+
+// Dot returns the dot product of a and b.
+func (a Point3D) Dot(b Point3D) float64 {
+	return a.X*b.X + a.Y*b.Y + a.Z*b.Z
+}
+
+// Cross returns the cross product of a and b.
+func (a Point3D) Cross(b Point3D) Point3D {
+	return Point3D{a.Y*b.Z - a.Z*b.Y, a.Z*b.X - a.X*b.Z, a.X*b.Y - a.Y*b.X}
+}
+
+// Length returns the length of a.
+func (a Point3D) Length() float64 {
+	return math.Sqrt(a.Dot(a))
+}
+
+// newell returns a vector at right angles to a face, given by the
+// indexes in pts of its corners, as long as twice its area, towards the
+// side from which the corners go CCW.  Newell's method is meant for
+// faces that aren't quite flat.
+func newell(pts []Point3D, face []int) Point3D {
+	var n Point3D
+	for k, i := range face {
+		p, q := pts[i], pts[face[(k+1)%len(face)]]
+		n.X += (p.Y - q.Y) * (p.Z + q.Z)
+		n.Y += (p.Z - q.Z) * (p.X + q.X)
+		n.Z += (p.X - q.X) * (p.Y + q.Y)
+	}
+	return n
+}
+
+// Normal returns the unit normal of a face, given by the indexes in pts
+// of its corners, on the side from which the corners go CCW.
+func Normal(pts []Point3D, face []int) Point3D {
+	n := newell(pts, face)
+	return n.Scale(1 / n.Length())
+}
+
+// Area returns the area of a face, given by the indexes in pts of its
+// corners.
+func Area(pts []Point3D, face []int) float64 {
+	return newell(pts, face).Length() / 2
+}
+
+// Centroid returns the average of the corners of a face, given by their
+// indexes in pts.
+func Centroid(pts []Point3D, face []int) Point3D {
+	var c Point3D
+	for _, i := range face {
+		c = c.Add(pts[i])
+	}
+	return c.Scale(1 / float64(len(face)))
+}
+
+// Volume returns the volume inside faces given by the indexes in pts of
+// their corners, positive if they go CCW seen from outside.
+func Volume(pts []Point3D, faces [][]int) float64 {
+	v := 0.0
+	for _, f := range faces {
+		p0 := pts[f[0]]
+		for k := 1; k+1 < len(f); k++ {
+			v += p0.Dot(pts[f[k]].Cross(pts[f[k+1]]))
+		}
+	}
+	return v / 6
+}
+
+// A Net is a flat net to be folded.
+type Net struct {
+	Faces    []*Edge // an edge of each polygon, with the polygon on its left
+	Boundary []*Edge // the edges around the net in CCW order, with the net on their left
+}
+
+// A Solid is a folded net.
+type Solid struct {
+	Vertices []Point3D
+	Faces    [][]int  // vertices of each of Net.Faces, CCW seen from outside
+	Pairs    [][2]int // indexes in Net.Boundary of edges glued together
+	Hinges   []Hinge  // every edge of the solid
+	Error    float64  // largest error in the shape of any polygon, relative to the average edge length
+}
+
+// A Hinge is an edge of a solid, where two faces meet.
+type Hinge struct {
+	Edge        *Edge   // edge of the net, with face Left on its left
+	Glued       *Edge   // if Edge is on the boundary, the edge it is glued to, with face Right on its left
+	Left, Right int     // indexes in Net.Faces
+	Dihedral    float64 // angle between the faces, inside the solid, in degrees
+}
+
+var (
+	ErrOpen    = errors.New("the net doesn't fold into a closed solid")
+	ErrTooHard = errors.New("gave up looking for a way to fold the net")
+)
+
+// Limits on the search for a gluing: the number of partial gluings
+// looked at, and the number of complete ones relaxed.
+var (
+	MaxSteps = 50000
+	MaxTries = 100
+)
+
+const (
+	angleTolerance  = 1e-6 // radians
+	lengthTolerance = 1e-6 // relative to the average edge length
+	shapeTolerance  = 1e-5 // relative to the average edge length
+	convexTolerance = 0.01 // degrees
+)
+
+// Fold folds a net into a convex solid, or returns ErrOpen if there is
+// no way to do so.
+func Fold(net *Net) (*Solid, error) {
+	f, angles, err := newFolder(net)
+	if err != nil {
+		return nil, err
+	}
+	n := len(net.Boundary)
+	if n%2 != 0 {
+		return nil, ErrOpen // edges are glued in pairs
+	}
+	for _, a := range angles {
+		if a > 2*math.Pi+angleTolerance {
+			return nil, ErrOpen // all of these corners end up at one vertex
+		}
+	}
+	cycle := make([]int, n)
+	for i := range cycle {
+		cycle[i] = i
+	}
+	f.failed = make(map[string]bool)
+	f.partner = make([]int, n)
+	for i := range f.partner {
+		f.partner[i] = -1
+	}
+	if f.zip(cycle, angles) {
+		return f.solid, nil
+	}
+	if f.steps > MaxSteps || f.tries > MaxTries {
+		return nil, ErrTooHard
+	}
+	return nil, ErrOpen
+}
+
+// Glue folds a net into a convex solid with the boundary edges glued
+// together in the given pairs of indexes in net.Boundary, as when they
+// are known from the solid the net was unfolded from, or returns
+// ErrOpen if that doesn't make one.
+func Glue(net *Net, pairs [][2]int) (*Solid, error) {
+	f, _, err := newFolder(net)
+	if err != nil {
+		return nil, err
+	}
+	n := len(net.Boundary)
+	if 2*len(pairs) != n {
+		return nil, ErrOpen // every edge must be glued to another
+	}
+	glued := make([]bool, n)
+	for _, p := range pairs {
+		for _, i := range p {
+			if i < 0 || i >= n || glued[i] {
+				return nil, fmt.Errorf("boundary edge %d is not glued to exactly one edge", i)
+			}
+			glued[i] = true
+		}
+		if math.Abs(f.length[p[0]]-f.length[p[1]]) > lengthTolerance*f.scale ||
+			!f.glue(net.Boundary[p[0]], net.Boundary[p[1]]) {
+			return nil, ErrOpen
+		}
+	}
+	f.pairs = pairs
+	if f.solid = f.realize(); f.solid == nil {
+		return nil, ErrOpen
+	}
+	return f.solid, nil
+}
+
+// newFolder sets up to fold a net, returning the angle of the net at
+// the start of each boundary edge.
+func newFolder(net *Net) (*folder, []float64, error) {
+	if len(net.Faces) == 0 || len(net.Boundary) == 0 {
+		return nil, nil, ErrOpen
+	}
+	f := &folder{net: net, vertex: make(map[Edge]int), face: make(map[Edge]int)}
+	for i, e := range net.Faces {
+		for e1 := e; ; {
+			f.face[*e1] = i
+			if _, ok := f.vertex[*e1]; !ok {
+				for e2 := e1; ; {
+					f.vertex[*e2] = f.nv
+					if e2 = e2.Onext(); *e2 == *e1 {
+						break
+					}
+				}
+				f.nv++
+			}
+			f.scale += length(e1)
+			f.nedges++
+			if e1 = e1.Lnext(); *e1 == *e {
+				break
+			}
+		}
+	}
+	f.scale /= float64(f.nedges)
+	f.class = make([]int, f.nv)
+	f.members = make([][]int, f.nv)
+	f.faces = make([][]int, f.nv)
+	f.out = make([][]int, f.nv)
+	f.in = make([][]int, f.nv)
+	for v := range f.class {
+		f.class[v] = v
+		f.members[v] = []int{v}
+	}
+	for e, i := range f.face {
+		u, v := f.vertex[e], f.vertex[*e.Sym()]
+		f.faces[u] = append(f.faces[u], i)
+		f.out[u] = append(f.out[u], v)
+		f.in[v] = append(f.in[v], u)
+	}
+	n := len(net.Boundary)
+	f.length = make([]float64, n)
+	angles := make([]float64, n)
+	for i, e := range net.Boundary {
+		if _, ok := f.face[*e]; !ok {
+			return nil, nil, fmt.Errorf("boundary edge %d is not an edge of the net", i)
+		}
+		f.length[i] = length(e)
+		a, err := f.angle(net.Boundary[(i+n-1)%n], e)
+		if err != nil {
+			return nil, nil, err
+		}
+		angles[i] = a
+	}
+	return f, angles, nil
+}
+
+type folder struct {
+	net     *Net
+	vertex  map[Edge]int // vertex of the net at the origin of each edge
+	face    map[Edge]int // face to the left of each edge
+	nv      int          // number of vertices of the net
+	nedges  int
+	scale   float64   // average edge length
+	length  []float64 // length of each boundary edge
+	pairs   [][2]int
+	partner []int           // the edge each boundary edge is glued to, or -1
+	failed  map[string]bool // partial gluings that lead nowhere
+	steps   int
+	tries   int
+	solid   *Solid
+
+	// vertices of the net glued together by the pairs so far
+	class   []int   // each vertex's class
+	members [][]int // the vertices in each class
+	faces   [][]int // faces at each vertex
+	out, in [][]int // ends of the edges from and to each vertex
+	merges  []merge // for undoing
+}
+
+func length(e *Edge) float64 {
+	return math.Hypot(e.Dest().X-e.Org().X, e.Dest().Y-e.Org().Y)
+}
+
+// angle returns the angle of the net between the boundary edge a and the
+// next boundary edge b, adding up the corners of the polygons between
+// them.
+func (f *folder) angle(a, b *Edge) (float64, error) {
+	if f.vertex[*a.Sym()] != f.vertex[*b] {
+		return 0, errors.New("the boundary of the net is not connected")
+	}
+	sum := 0.0
+	for e := b; *e != *a.Sym(); e = e.Onext() {
+		e1 := e.Onext()
+		d := math.Atan2(e1.Dest().Y-e1.Org().Y, e1.Dest().X-e1.Org().X) -
+			math.Atan2(e.Dest().Y-e.Org().Y, e.Dest().X-e.Org().X)
+		for d <= 0 {
+			d += 2 * math.Pi
+		}
+		sum += d
+	}
+	return sum, nil
+}
+
+// zip glues the rest of the boundary, given as a cycle of boundary edges
+// and the angle of the net at the start of each, trying each way of
+// doing so until one folds into a solid.
+func (f *folder) zip(cycle []int, angles []float64) bool {
+	n := len(cycle)
+	if n == 0 {
+		f.tries++
+		f.solid = f.realize()
+		return f.solid != nil
+	}
+	f.steps++
+	if f.steps > MaxSteps || f.tries > MaxTries {
+		return false
+	}
+	// The pairs glued so far decide everything else, whatever order
+	// they were glued in.
+	key := make([]byte, 0, 2*len(f.partner))
+	for _, j := range f.partner {
+		key = append(key, byte(j), byte(j>>8))
+	}
+	if f.failed[string(key)] {
+		return false
+	}
+	// A vertex of the solid at the end of a cut is all in one place in
+	// the net, while one that a cut passes through is split up, so
+	// try the widest corners first.
+	order := make([]int, n)
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(i, j int) bool { return angles[order[i]] > angles[order[j]] })
+	tries := f.tries
+	for _, k := range order {
+		if angles[k] >= 2*math.Pi-angleTolerance {
+			continue
+		}
+		i := (k + n - 1) % n
+		if math.Abs(f.length[cycle[i]]-f.length[cycle[k]]) > lengthTolerance*f.scale {
+			continue
+		}
+		var cycle1 []int
+		var angles1 []float64
+		if n == 2 {
+			if angles[i] > 2*math.Pi+angleTolerance {
+				continue
+			}
+		} else {
+			// the vertices at the start of i and the end of k become one
+			merged := angles[i] + angles[(k+1)%n]
+			if merged > 2*math.Pi+angleTolerance {
+				continue
+			}
+			for j := (k + 1) % n; j != i; j = (j + 1) % n {
+				cycle1 = append(cycle1, cycle[j])
+				angles1 = append(angles1, angles[j])
+			}
+			angles1[0] = merged
+		}
+		mark := len(f.merges)
+		if f.glue(f.net.Boundary[cycle[i]], f.net.Boundary[cycle[k]]) {
+			f.pairs = append(f.pairs, [2]int{cycle[i], cycle[k]})
+			f.partner[cycle[i]], f.partner[cycle[k]] = cycle[k], cycle[i]
+			if f.zip(cycle1, angles1) {
+				return true
+			}
+			f.pairs = f.pairs[:len(f.pairs)-1]
+			f.partner[cycle[i]], f.partner[cycle[k]] = -1, -1
+		}
+		f.unglue(mark)
+	}
+	if f.tries == tries {
+		// nothing below here even glued the whole boundary, so this
+		// is a dead end however it was reached
+		f.failed[string(key)] = true
+	}
+	return false
+}
+
+type merge struct {
+	into, from int // classes
+	n          int // size of into before
+}
+
+// glue glues boundary edge a to boundary edge b, joining the vertices at
+// their ends.  It returns false if that would join two corners of the
+// same polygon, or make two different edges of the solid between the
+// same vertices; the caller must then unglue.
+func (f *folder) glue(a, b *Edge) bool {
+	return f.union(f.vertex[*a], f.vertex[*b.Sym()]) && f.union(f.vertex[*a.Sym()], f.vertex[*b])
+}
+
+func (f *folder) union(u, v int) bool {
+	into, from := f.class[u], f.class[v]
+	if into == from {
+		return true
+	}
+	if len(f.members[into]) < len(f.members[from]) {
+		into, from = from, into
+	}
+	faces := make(map[int]bool)
+	for _, w := range f.members[into] {
+		for _, i := range f.faces[w] {
+			faces[i] = true
+		}
+	}
+	for _, w := range f.members[from] {
+		for _, i := range f.faces[w] {
+			if faces[i] {
+				return false
+			}
+		}
+	}
+	f.merges = append(f.merges, merge{into, from, len(f.members[into])})
+	for _, w := range f.members[from] {
+		f.class[w] = into
+	}
+	f.members[into] = append(f.members[into], f.members[from]...)
+	for _, ends := range [][][]int{f.out, f.in} {
+		seen := make(map[int]bool)
+		for _, w := range f.members[into] {
+			for _, x := range ends[w] {
+				if seen[f.class[x]] {
+					return false
+				}
+				seen[f.class[x]] = true
+			}
+		}
+	}
+	return true
+}
+
+// unglue undoes gluing back to the given number of merges.
+func (f *folder) unglue(mark int) {
+	for len(f.merges) > mark {
+		m := f.merges[len(f.merges)-1]
+		f.merges = f.merges[:len(f.merges)-1]
+		f.members[m.into] = f.members[m.into][:m.n]
+		for _, w := range f.members[m.from] {
+			f.class[w] = m.from
+		}
+	}
+}
+
+// realize finds positions for the vertices of the solid given by the
+// current gluing, or returns nil if there are none.
+func (f *folder) realize() *Solid {
+	index := make(map[int]int)
+	v := func(e *Edge) int {
+		r := f.class[f.vertex[*e]]
+		if _, ok := index[r]; !ok {
+			index[r] = len(index)
+		}
+		return index[r]
+	}
+
+	// faces, and the distances between vertices that keep their shapes
+	s := &Solid{Pairs: append([][2]int(nil), f.pairs...)}
+	type pair struct{ i, j int }
+	dist := make(map[pair]float64)
+	directed := make(map[pair]bool)
+	for _, e := range f.net.Faces {
+		var face []int
+		var pts []*Point2D
+		for e1 := e; ; {
+			face = append(face, v(e1))
+			pts = append(pts, e1.Org())
+			if e1 = e1.Lnext(); *e1 == *e {
+				break
+			}
+		}
+		n := len(face)
+		for k, i := range face {
+			directed[pair{i, face[(k+1)%n]}] = true
+		}
+		// a polygon is rigid if every vertex keeps its distance from
+		// three others that aren't in a line
+		for _, a := range []int{0, n / 3, 2 * n / 3} {
+			for b := range face {
+				if a == b {
+					continue
+				}
+				p := pair{face[a], face[b]}
+				if p.i > p.j {
+					p = pair{p.j, p.i}
+				}
+				d := math.Hypot(pts[a].X-pts[b].X, pts[a].Y-pts[b].Y)
+				if d0, ok := dist[p]; ok && math.Abs(d-d0) > lengthTolerance*f.scale {
+					return nil
+				}
+				dist[p] = d
+			}
+		}
+		s.Faces = append(s.Faces, face)
+	}
+	for p := range directed {
+		if !directed[pair{p.j, p.i}] {
+			return nil // not closed
+		}
+	}
+	nv := len(index)
+	if nv-len(directed)/2+len(s.Faces) != 2 {
+		return nil // not a sphere
+	}
+
+	// sort the distances so that the relaxation is deterministic
+	var constraints []constraint
+	for p, d := range dist {
+		constraints = append(constraints, constraint{p.i, p.j, d})
+	}
+	sort.Slice(constraints, func(a, b int) bool {
+		if constraints[a].i != constraints[b].i {
+			return constraints[a].i < constraints[b].i
+		}
+		return constraints[a].j < constraints[b].j
+	})
+	s.Vertices = embed(nv, constraints)
+	s.Error = relax(s.Vertices, constraints, shapeTolerance*f.scale/100) / f.scale
+	if s.Error > shapeTolerance {
+		return nil
+	}
+	vol := Volume(s.Vertices, s.Faces)
+	if math.Abs(vol) < shapeTolerance*f.scale*f.scale*f.scale {
+		return nil // flat
+	}
+	if vol < 0 { // inside out: the printed side should be outside
+		for i := range s.Vertices {
+			s.Vertices[i].Z = -s.Vertices[i].Z
+		}
+	}
+
+	// the angle at each edge of the solid
+	for i, e := range f.net.Faces {
+		for e1 := e; ; {
+			if j, ok := f.face[*e1.Sym()]; ok && i < j {
+				s.Hinges = append(s.Hinges, Hinge{Edge: e1, Left: i, Right: j})
+			}
+			if e1 = e1.Lnext(); *e1 == *e {
+				break
+			}
+		}
+	}
+	for _, p := range s.Pairs {
+		a, b := f.net.Boundary[p[0]], f.net.Boundary[p[1]]
+		s.Hinges = append(s.Hinges, Hinge{Edge: a, Glued: b, Left: f.face[*a], Right: f.face[*b]})
+	}
+	for k := range s.Hinges {
+		h := &s.Hinges[k]
+		h.Dihedral = dihedral(s, h.Left, h.Right, v(h.Edge), v(h.Edge.Sym()))
+		if h.Dihedral > 180+convexTolerance {
+			return nil
+		}
+	}
+	return s
+}
+
+type constraint struct {
+	i, j int
+	d    float64
+}
+
+// embed guesses positions for n vertices, given some of the distances
+// between them.  Distances that aren't given are taken to be the
+// shortest path through those that are, and the positions are the best
+// fit to all of the distances in three dimensions.
+func embed(n int, constraints []constraint) []Point3D {
+	d := make([][]float64, n)
+	for i := range d {
+		d[i] = make([]float64, n)
+		for j := range d[i] {
+			if i != j {
+				d[i][j] = math.Inf(1)
+			}
+		}
+	}
+	for _, c := range constraints {
+		d[c.i][c.j] = c.d
+		d[c.j][c.i] = c.d
+	}
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if d[i][k]+d[k][j] < d[i][j] {
+					d[i][j] = d[i][k] + d[k][j]
+				}
+			}
+		}
+	}
+	// double centered squared distances
+	b := make([][]float64, n)
+	row := make([]float64, n)
+	all := 0.0
+	for i := range b {
+		b[i] = make([]float64, n)
+		for j := range b[i] {
+			b[i][j] = d[i][j] * d[i][j]
+			row[i] += b[i][j] / float64(n)
+		}
+		all += row[i] / float64(n)
+	}
+	for i := range b {
+		for j := range b[i] {
+			b[i][j] = -(b[i][j] - row[i] - row[j] + all) / 2
+		}
+	}
+	// the three largest eigenvectors, by power iteration
+	pts := make([]Point3D, n)
+	for axis := 0; axis < 3; axis++ {
+		x := make([]float64, n)
+		for i := range x {
+			x[i] = math.Sin(float64((axis+1)*(i+1)) + float64(axis))
+		}
+		lambda := 0.0
+		for iter := 0; iter < 1000; iter++ {
+			y := make([]float64, n)
+			for i := range b {
+				for j, bij := range b[i] {
+					y[i] += bij * x[j]
+				}
+			}
+			norm := 0.0
+			for _, yi := range y {
+				norm += yi * yi
+			}
+			norm = math.Sqrt(norm)
+			if norm == 0 {
+				break
+			}
+			for i := range y {
+				y[i] /= norm
+			}
+			lambda = norm
+			x = y
+		}
+		for i := range b {
+			for j := range b[i] {
+				b[i][j] -= lambda * x[i] * x[j]
+			}
+		}
+		l := math.Sqrt(math.Max(lambda, 0))
+		for i := range pts {
+			switch axis {
+			case 0:
+				pts[i].X = l * x[i]
+			case 1:
+				pts[i].Y = l * x[i]
+			case 2:
+				pts[i].Z = l * x[i]
+			}
+		}
+	}
+	return pts
+}
+
+// relax moves the points until they are the given distances apart, to
+// within tolerance, and returns the largest error that remains.
+func relax(pts []Point3D, constraints []constraint, tolerance float64) float64 {
+	worst, before := math.Inf(1), math.Inf(1)
+	for iter := 0; iter < 20000 && worst > tolerance; iter++ {
+		if iter%500 == 0 {
+			if worst > before/2 {
+				break // stuck
+			}
+			before = worst
+		}
+		worst = 0
+		for _, c := range constraints {
+			p, q := &pts[c.i], &pts[c.j]
+			dx, dy, dz := q.X-p.X, q.Y-p.Y, q.Z-p.Z
+			l := math.Sqrt(dx*dx + dy*dy + dz*dz)
+			if l == 0 {
+				dx, l = 1, 1 // any direction will do
+			}
+			worst = math.Max(worst, math.Abs(l-c.d))
+			k := (l - c.d) / l / 2
+			p.X, p.Y, p.Z = p.X+k*dx, p.Y+k*dy, p.Z+k*dz
+			q.X, q.Y, q.Z = q.X-k*dx, q.Y-k*dy, q.Z-k*dz
+		}
+	}
+	return worst
+}
+
+// dihedral returns the angle inside the solid between the faces left and
+// right, which meet at the edge from vertex i to vertex j of left.
+func dihedral(s *Solid, left, right, i, j int) float64 {
+	n1, n2 := Normal(s.Vertices, s.Faces[left]), Normal(s.Vertices, s.Faces[right])
+	a := math.Acos(math.Max(-1, math.Min(1, n1.Dot(n2))))
+	if n1.Cross(n2).Dot(s.Vertices[j].Sub(s.Vertices[i])) < 0 {
+		a = -a // reflex
+	}
+	return 180 - a/math.Pi*180
+}
+
+// WriteOBJ writes the solid as a Wavefront OBJ file.
+func (s *Solid) WriteOBJ(w io.Writer) error {
+	for _, p := range s.Vertices {
+		if _, err := fmt.Fprintf(w, "v %g %g %g\n", p.X, p.Y, p.Z); err != nil {
+			return err
+		}
+	}
+	for _, f := range s.Faces {
+		line := "f"
+		for _, i := range f {
+			line += fmt.Sprintf(" %d", i+1)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package geom
+
+import (
+	. "../quadedge"
+	"math"
+)
+
+/* Plane geometry for polygons given as lists of points.
+
+   Nets are drawn at the size of the paper, so distances smaller than
+   Epsilon are taken to be zero: polygons whose edges lie along each
+   other, or whose corners touch, don't overlap.
+*/
+
+var Epsilon = 1e-6
+
+// side returns the distance of c from the line through a and b, positive
+// if c is to the left.
+func side(a, b, c *Point2D) float64 {
+	l := math.Hypot(b.X-a.X, b.Y-a.Y)
+	if l == 0 {
+		return math.Hypot(c.X-a.X, c.Y-a.Y)
+	}
+	return ((b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)) / l
+}
+
+// Cross reports whether the segments ab and cd cross each other at a
+// point inside both.
+func Cross(a, b, c, d *Point2D) bool {
+	s1, s2 := side(a, b, c), side(a, b, d)
+	s3, s4 := side(c, d, a), side(c, d, b)
+	return (s1 > Epsilon && s2 < -Epsilon || s1 < -Epsilon && s2 > Epsilon) &&
+		(s3 > Epsilon && s4 < -Epsilon || s3 < -Epsilon && s4 > Epsilon)
+}
+
+// Inside reports whether p is inside the polygon, and not on its
+// boundary.
+func Inside(p *Point2D, poly []*Point2D) bool {
+	n := len(poly)
+	in := false
+	for i, a := range poly {
+		b := poly[(i+1)%n]
+		if onSegment(p, a, b) {
+			return false
+		}
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < a.X+(p.Y-a.Y)/(b.Y-a.Y)*(b.X-a.X) {
+			in = !in
+		}
+	}
+	return in
+}
+
+func onSegment(p, a, b *Point2D) bool {
+	l := math.Hypot(b.X-a.X, b.Y-a.Y)
+	if l == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y) <= Epsilon
+	}
+	t := ((p.X-a.X)*(b.X-a.X) + (p.Y-a.Y)*(b.Y-a.Y)) / (l * l)
+	return math.Abs(side(a, b, p)) <= Epsilon && t >= -Epsilon/l && t <= 1+Epsilon/l
+}
+
+// Area returns the area of a polygon, positive if it is CCW.
+func Area(poly []*Point2D) float64 {
+	a := 0.0
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a / 2
+}
+
+// InteriorPoint returns a point inside a simple polygon.
+func InteriorPoint(poly []*Point2D) *Point2D {
+	n := len(poly)
+	// the leftmost corner is convex; cut it off, or if that would cut
+	// through the polygon, go halfway to the nearest corner in the way
+	k := 0
+	for i, p := range poly {
+		if p.X < poly[k].X || p.X == poly[k].X && p.Y < poly[k].Y {
+			k = i
+		}
+	}
+	v, a, b := poly[k], poly[(k+n-1)%n], poly[(k+1)%n]
+	tri := []*Point2D{a, v, b}
+	var nearest *Point2D
+	for i, p := range poly {
+		if i == k || i == (k+n-1)%n || i == (k+1)%n {
+			continue
+		}
+		if Inside(p, tri) && (nearest == nil || math.Hypot(p.X-v.X, p.Y-v.Y) < math.Hypot(nearest.X-v.X, nearest.Y-v.Y)) {
+			nearest = p
+		}
+	}
+	if nearest != nil {
+		return &Point2D{(v.X + nearest.X) / 2, (v.Y + nearest.Y) / 2}
+	}
+	return &Point2D{(a.X + v.X + b.X) / 3, (a.Y + v.Y + b.Y) / 3}
+}
+
+// Overlap reports whether two simple polygons overlap.  Polygons that
+// only touch, along edges or at corners, don't.
+func Overlap(p, q []*Point2D) bool {
+	for i, a := range p {
+		b := p[(i+1)%len(p)]
+		for j, c := range q {
+			if Cross(a, b, c, q[(j+1)%len(q)]) {
+				return true
+			}
+		}
+	}
+	// no edges cross, so either one is inside the other or they are
+	// apart, but they may share corners and edges
+	for _, pair := range [][2][]*Point2D{{p, q}, {q, p}} {
+		r, s := pair[0], pair[1]
+		if Inside(InteriorPoint(r), s) {
+			return true
+		}
+		for i, a := range r {
+			b := r[(i+1)%len(r)]
+			if Inside(a, s) || Inside(&Point2D{(a.X + b.X) / 2, (a.Y + b.Y) / 2}, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
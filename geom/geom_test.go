@@ -0,0 +1,84 @@
+package geom
+
+import (
+	. "../quadedge"
+	"testing"
+)
+
+// poly makes a polygon from pairs of coordinates.
+func poly(xy ...float64) []*Point2D {
+	var pts []*Point2D
+	for i := 0; i+1 < len(xy); i += 2 {
+		pts = append(pts, &Point2D{xy[i], xy[i+1]})
+	}
+	return pts
+}
+
+var (
+	square = poly(0, 0, 1, 0, 1, 1, 0, 1)
+	notch  = poly(0, 0, 3, 0, 3, 3, 2, 3, 2, 1, 1, 1, 1, 3, 0, 3) // a U
+)
+
+func TestInside(t *testing.T) {
+	for _, tt := range []struct {
+		x, y float64
+		poly []*Point2D
+		want bool
+	}{
+		{0.5, 0.5, square, true},
+		{1.5, 0.5, square, false},
+		{0, 0.5, square, false},    // on an edge
+		{1, 1, square, false},      // on a corner
+		{0.5, 1e-9, square, false}, // within Epsilon of an edge
+		{0.5, 1e-3, square, true},
+		{1.5, 2, notch, false}, // in the gap of the U
+		{0.5, 2, notch, true},
+		{1.5, 0.5, notch, true},
+		{1.5, 1, notch, false},
+	} {
+		if got := Inside(&Point2D{tt.x, tt.y}, tt.poly); got != tt.want {
+			t.Errorf("Inside(%g, %g) in %d-gon = %v, want %v", tt.x, tt.y, len(tt.poly), got, tt.want)
+		}
+	}
+}
+
+func TestInteriorPoint(t *testing.T) {
+	for _, p := range [][]*Point2D{
+		square,
+		notch,
+		poly(0, 0, 4, -1, 1, 0, 4, 1), // an arrowhead, whose leftmost corner can't be cut off
+	} {
+		if q := InteriorPoint(p); !Inside(q, p) {
+			t.Errorf("InteriorPoint(%v) = %v, which isn't inside", p, q)
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		p, q []*Point2D
+		want bool
+	}{
+		{"apart", square, poly(2, 0, 3, 0, 3, 1, 2, 1), false},
+		{"sharing an edge", square, poly(1, 0, 2, 0, 2, 1, 1, 1), false},
+		{"sharing part of an edge", square, poly(1, 0.5, 2, 0.5, 2, 1.5, 1, 1.5), false},
+		{"touching at a corner", square, poly(1, 1, 2, 1, 2, 2, 1, 2), false},
+		{"corner on an edge", square, poly(1, 0.5, 2, 0, 2, 1), false},
+		{"edges crossing", square, poly(0.5, 0.5, 1.5, 0.5, 1.5, 1.5, 0.5, 1.5), true},
+		{"inside", square, poly(0.25, 0.25, 0.75, 0.25, 0.75, 0.75), true},
+		{"the same", square, square, true},
+		{"the same, other way round", square, poly(0, 0, 0, 1, 1, 1, 1, 0), true},
+		{"sharing two edges", square, poly(0, 0, 1, 0, 1, 1), true},
+		{"in the gap of a U", notch, poly(1, 1, 2, 1, 2, 3, 1, 3), false},
+		{"across a U", notch, poly(0.5, 1.5, 2.5, 1.5, 2.5, 2.5, 0.5, 2.5), true},
+		{"overlapping by less than Epsilon", square, poly(1-1e-9, 0, 2, 0, 2, 1, 1-1e-9, 1), false},
+	} {
+		if got := Overlap(tt.p, tt.q); got != tt.want {
+			t.Errorf("%s: Overlap = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := Overlap(tt.q, tt.p); got != tt.want {
+			t.Errorf("%s, swapped: Overlap = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
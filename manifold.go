@@ -1,9 +1,15 @@
 package main
 
 import (
+	"./fold"
+	"./geom"
+	"./mesh"
+	"./polyhedra"
 	. "./quadedge"
+	"./script"
 	"fmt"
 	"github.com/ajstarks/svgo/float"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
@@ -11,6 +17,21 @@ import (
 	"os"
 	//	"text/template"
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"html"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 var fileno int = 0
@@ -124,13 +145,13 @@ func absAngle(rad float64) float64 {
 	return rad / math.Pi * 180
 }
 
-func tab0(pts []*Point2D) *Edge {
+func (m *Model) tab0(pts []*Point2D) *Edge {
 	p := Polygon(pts)
 	for _, e := range p.Edges() {
 		if *e == *p {
 			continue
 		}
-		tabEdge[e.Q] = true
+		m.tabEdge[e.Q] = true
 	}
 	return p
 }
@@ -139,21 +160,162 @@ func traySide() *Edge {
 	return Polygon([]*Point2D{{0, 0}, {100, 0}, {110, 30}, {-10, 30}})
 }
 
-func tab(e *Edge) *Edge { // a tab that pays attention to narrow angles
+func (m *Model) tab(e *Edge, style TabStyle) *Edge { // a tab that pays attention to narrow angles
+	return m.tab0(m.tabPoints(e, style))
+}
+
+// fitTab returns the style of the biggest tab like the given one that
+// fits on the perimeter edge e without overlapping polys, the polygons
+// of the rest of the net, tabs included.  A tab that doesn't fit is made
+// lower, then for each height its sides lean in further, so that it is
+// narrower at the top.  If no tab fits, fitTab returns the smallest, and
+// false.
+func (m *Model) fitTab(e *Edge, style TabStyle, polys [][]*Point2D) (TabStyle, bool) {
+	fitted := style
+	for _, height := range []float64{1, 0.75, 0.5, 0.35, 0.25} {
+		for _, angle := range []float64{1, 0.67, 0.5, 0.33} {
+			if style.Shape == "slot" && angle != 1 {
+				continue // the sides of a slot tab are fixed
+			}
+			fitted = style
+			fitted.Height *= height
+			fitted.Angle *= angle
+			tab := Polygon(m.tabPoints(e, fitted))
+			if !place(e, tab) {
+				return style, true
+			}
+			pts := points(tab)
+			overlaps := false
+			for _, poly := range polys {
+				if geom.Overlap(pts, poly) {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				return fitted, true
+			}
+		}
+	}
+	return fitted, false
+}
+
+// addTab attaches a tab in the given style to the edge at the cursor,
+// and moves the cursor on.
+func (m *Model) addTab(style TabStyle) {
+	e := m.e0
+	m.attachAndMove(m.tab(e, style))
+	if style.Shape == "slot" {
+		m.slots[e.Q] = m.tabHeight(edgeLength(e), style) / 2
+	}
+}
+
+// A TabStyle gives the shape and size of tabs.
+type TabStyle struct {
+	Shape  string  // one of tabShapes
+	Height float64 // in Units, or as a fraction of the edge if Units is ""
+	Units  string
+	Angle  float64 // between the edge and the sides of the tab, in degrees
+	Radius float64 // of the outer corners, as a fraction of the height
+}
+
+var defaultTabStyle = TabStyle{Shape: "plain", Height: 0.25, Angle: 45}
+
+// Tabs are plain trapezoids (or triangles on short edges); notched, with
+// a notch in the middle so that they bend along a curved edge; zigzag,
+// with pinked edges; or slot, with a head that locks into a slit in the
+// edge the tab is glued to, so that no glue is needed.
+var tabShapes = []string{"plain", "notched", "zigzag", "slot"}
+
+var unitsPerInch = map[string]float64{"in": 1, "cm": 2.54, "mm": 25.4}
+
+// parseTabStyle returns the tab style given by the arguments of t or
+// tabs: the shape, then optionally the height, the angle of the sides and
+// the radius of the outer corners.  A height with units, such as 5mm or
+// 0.2in, is absolute, and a number alone is a fraction of the edge.
+// Arguments that are left out or empty are taken from the model's tab
+// style.
+func (m *Model) parseTabStyle(cmd script.Command) (TabStyle, error) {
+	style := m.tabStyle
+	args := cmd.Args
+	if len(args) > 4 {
+		return style, fmt.Errorf("%s takes a shape, height, angle and radius", cmd.Op)
+	}
+	if len(args) > 0 && args[0] != "" {
+		style.Shape = ""
+		for _, shape := range tabShapes {
+			if args[0] == shape {
+				style.Shape = shape
+			}
+		}
+		if style.Shape == "" {
+			return style, fmt.Errorf("No tab shape %s; try %s", args[0], strings.Join(tabShapes, ", "))
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		height, units := args[1], ""
+		for u := range unitsPerInch {
+			if strings.HasSuffix(height, u) {
+				height, units = strings.TrimSpace(strings.TrimSuffix(height, u)), u
+			}
+		}
+		h, err := strconv.ParseFloat(height, 64)
+		if err != nil || !(h > 0) || units == "" && h > 1 || math.IsInf(h, 0) {
+			return style, fmt.Errorf("%s: bad height %s; try a fraction of the edge, like 0.25, or a length, like 5mm", cmd.Op, args[1])
+		}
+		style.Height, style.Units = h, units
+	}
+	if len(args) > 2 && args[2] != "" {
+		a, err := cmd.Float(2)
+		if err != nil || !(a > 0 && a < 90) {
+			return style, fmt.Errorf("%s: the angle must be between 0 and 90 degrees", cmd.Op)
+		}
+		style.Angle = a
+	}
+	if len(args) > 3 && args[3] != "" {
+		r, err := cmd.Float(3)
+		if err != nil || !(r >= 0 && r <= 1) {
+			return style, fmt.Errorf("%s: the radius must be between 0 and 1", cmd.Op)
+		}
+		style.Radius = r
+	}
+	return style, nil
+}
+
+// tabHeight returns the height of a tab in the given style on an edge of
+// the given length, as a fraction of the length.
+func (m *Model) tabHeight(length float64, style TabStyle) float64 {
+	if style.Units == "" {
+		return style.Height
+	}
+	perInch := m.paper.Width / m.paper.UnitWidth * unitsPerInch[m.paper.Units]
+	return style.Height / unitsPerInch[style.Units] * perInch / length
+}
+
+// tabPoints returns the corners of a tab in the given style for the
+// perimeter edge e, to be attached by its first edge.
+func (m *Model) tabPoints(e *Edge, style TabStyle) []*Point2D {
+	h := 4 * m.tabHeight(edgeLength(e), style) // height of the tab below, where the edge is 4 long
+	if style.Shape == "slot" {
+		// a neck half as wide as the edge, under a wider head
+		s, n := h*0.15, h/2
+		return []*Point2D{{0, 0}, {4, 0}, {3, s}, {3, n}, {3.4, n}, {2.8, h}, {1.2, h}, {0.6, n}, {1, n}, {1, s}}
+	}
 	epsilon := 1e-10 // a bit bigger than zero to allow for inaccuracy in calculating angles
-	cwAngle := 45.0
+	cwAngle := style.Angle
 	cwSym := absAngle(edgeRadians(cwPerimeter(e)) - edgeRadians(e.Sym()))
 	if cwSym < epsilon && math.Abs(cwSym) < cwAngle {
 		cwAngle = math.Abs(cwSym)
 	}
-	ccwAngle := 45.0
+	ccwAngle := style.Angle
 	symCcw := absAngle(edgeRadians(e.Sym()) - edgeRadians(ccwPerimeter(e)))
 	if symCcw < epsilon && math.Abs(symCcw) < ccwAngle {
 		ccwAngle = math.Abs(symCcw)
 	}
 	alphaAngle := ccwAngle
 	betaAngle := cwAngle
-	/* Draw a tab with left and right angles alpha and beta, with height < width/4.
+	/* Draw a tab with left and right angles alpha and beta, with height h
+	   relative to a width of 4 (1 by default).
 
 	   There are two cases.
 
@@ -161,7 +323,7 @@ func tab(e *Edge) *Edge { // a tab that pays attention to narrow angles
 
 		     D-------------C              -
 		    /               \             |
-		   /                 \            1
+		   /                 \            h
 		  /                   \           |
 	   alpha A---------------------B beta     -
 
@@ -170,14 +332,14 @@ func tab(e *Edge) *Edge { // a tab that pays attention to narrow angles
 	   Here alpha is the angle BAD and beta is the angle ABC, and they are known.
 	   If A = (0, 0) and B = (4, 0),
 	   we need the coordinates of C and D:
-	   C = (4 - 1/tan(beta), 1)
-	   D = (1/tan(alpha), 1)
+	   C = (4 - h/tan(beta), h)
+	   D = (h/tan(alpha), h)
 
 	   Case 2:
 
 		     C              -
 		    / \             |
-		   /   \          h < 1
+		   /   \          < h
 		  /     \           |
 	   alpha A-------B beta     -
 
@@ -202,21 +364,82 @@ func tab(e *Edge) *Edge { // a tab that pays attention to narrow angles
 
 	       4*sin(beta)/sin(gamma)*cos(alpha), 4*sin(beta)/sin(gamma)*sin(alpha)
 
-	   To see whether we are in case 1 or two, check 4*sin(beta)/sin(gamma)*sin(alpha) < 1
+	   To see whether we are in case 1 or two, check 4*sin(beta)/sin(gamma)*sin(alpha) < h
+
+	   The corners at C and D are then rounded off, and the top edge
+	   notched or pinked, according to the style.
 	*/
 	gammaAngle := 180 - alphaAngle - betaAngle
 	alpha := alphaAngle / 180 * math.Pi
 	beta := betaAngle / 180 * math.Pi
 	gamma := gammaAngle / 180 * math.Pi
-	if 4*math.Sin(beta)/math.Sin(gamma)*math.Sin(alpha) < 1 {
+	a, b := &Point2D{0, 0}, &Point2D{4, 0}
+	r := style.Radius * h
+	if 4*math.Sin(beta)/math.Sin(gamma)*math.Sin(alpha) < h {
 		// case 2
-		pts := []*Point2D{{0, 0}, {4, 0}, {4 * math.Sin(beta) / math.Sin(gamma) * math.Cos(alpha), 4 * math.Sin(beta) / math.Sin(gamma) * math.Sin(alpha)}}
-		return tab0(pts)
-	} else {
-		// case 1
-		pts := []*Point2D{{0, 0}, {4, 0}, {4 - 1/math.Tan(beta), 1}, {1 / math.Tan(alpha), 1}}
-		return tab0(pts)
+		c := &Point2D{4 * math.Sin(beta) / math.Sin(gamma) * math.Cos(alpha), 4 * math.Sin(beta) / math.Sin(gamma) * math.Sin(alpha)}
+		return append([]*Point2D{a, b}, roundCorner(b, c, a, r)...)
+	}
+	// case 1
+	c, d := &Point2D{4 - h/math.Tan(beta), h}, &Point2D{h / math.Tan(alpha), h}
+	pts := append([]*Point2D{a, b}, roundCorner(b, c, d, r)...)
+	dArc := roundCorner(c, d, a, r)
+	from, to := pts[len(pts)-1], dArc[0] // the straight part of the top, from right to left
+	switch width := from.X - to.X; style.Shape {
+	case "notched":
+		w := math.Min(width/3, h/2)
+		mid := (from.X + to.X) / 2
+		pts = append(pts, &Point2D{mid + w/2, h}, &Point2D{mid, h / 3}, &Point2D{mid - w/2, h})
+	case "zigzag":
+		n := int(math.Max(2, math.Round(width/(h/2)))) // number of teeth
+		for i := 1; i < 2*n; i++ {
+			y := h
+			if i%2 == 1 {
+				y = h * 3 / 4
+			}
+			pts = append(pts, &Point2D{from.X - width*float64(i)/float64(2*n), y})
+		}
+	}
+	return append(pts, dArc...)
+}
+
+// roundCorner returns points along an arc of radius r that rounds off
+// the corner at b of a polygon with corners a, b and c, or just b if r is
+// zero.  The arc takes up at most half of either side, with a smaller
+// radius if need be.
+func roundCorner(a, b, c *Point2D, r float64) []*Point2D {
+	lu, lv := math.Hypot(a.X-b.X, a.Y-b.Y), math.Hypot(c.X-b.X, c.Y-b.Y)
+	if r <= 0 || lu == 0 || lv == 0 {
+		return []*Point2D{b}
+	}
+	ux, uy := (a.X-b.X)/lu, (a.Y-b.Y)/lu
+	vx, vy := (c.X-b.X)/lv, (c.Y-b.Y)/lv
+	theta := math.Acos(math.Max(-1, math.Min(1, ux*vx+uy*vy))) // the angle at b
+	if theta < 1e-9 || theta > math.Pi-1e-9 {
+		return []*Point2D{b}
+	}
+	d := r / math.Tan(theta/2) // from b to where the arc meets each side
+	if max := math.Min(lu, lv) / 2; d > max {
+		d = max
+		r = d * math.Tan(theta/2)
+	}
+	bx, by := (ux+vx)/math.Hypot(ux+vx, uy+vy), (uy+vy)/math.Hypot(ux+vx, uy+vy)
+	center := &Point2D{b.X + bx*r/math.Sin(theta/2), b.Y + by*r/math.Sin(theta/2)}
+	start := math.Atan2(b.Y+uy*d-center.Y, b.X+ux*d-center.X)
+	sweep := math.Atan2(b.Y+vy*d-center.Y, b.X+vx*d-center.X) - start
+	for sweep > math.Pi {
+		sweep -= 2 * math.Pi
 	}
+	for sweep < -math.Pi {
+		sweep += 2 * math.Pi
+	}
+	const steps = 8
+	pts := make([]*Point2D, steps+1)
+	for i := range pts {
+		angle := start + sweep*float64(i)/steps
+		pts[i] = &Point2D{center.X + r*math.Cos(angle), center.Y + r*math.Sin(angle)}
+	}
+	return pts
 }
 
 func halfsies(e *Edge) *Edge {
@@ -241,12 +464,14 @@ func halfsies(e *Edge) *Edge {
 	return e1
 }
 
-func attach(e1, e2 *Edge) {
-	debugDraw(e1, e2)
+// place moves, scales and rotates the subdivision of e2 so that e2 lies
+// on top of e1, in the opposite direction.  Returns false if either edge
+// has no length.
+func place(e1, e2 *Edge) bool {
 	l1 := edgeLength(e1)
 	l2 := edgeLength(e2)
 	if l1 == 0.0 || l2 == 0.0 {
-		return
+		return false
 	}
 	sf := l1 / l2
 	translate(e2, -e2.Org().X, -e2.Org().Y) // bring origin of e2 to absolute origin (0,0)
@@ -257,6 +482,32 @@ func attach(e1, e2 *Edge) {
 	debugDraw(e1, e2)
 	translate(e2, e1.Dest().X, e1.Dest().Y)
 	debugDraw(e1, e2)
+	return true
+}
+
+// mirror returns a mirror image of the polygon with edge e, as a new
+// polygon.  The edge returned is the image of e.
+func mirror(e *Edge) *Edge {
+	fwd := []*Point2D{e.Org()}
+	for e1 := e.Lnext(); *e1 != *e; e1 = e1.Lnext() {
+		fwd = append(fwd, e1.Org())
+	}
+	// reflect, and reverse to keep CCW orientation, starting with the
+	// image of e.Dest() so that the first edge is the image of e
+	n := len(fwd)
+	pts := make([]*Point2D, n)
+	for i := range pts {
+		p := fwd[(n+1-i)%n]
+		pts[i] = &Point2D{-p.X, p.Y}
+	}
+	return Polygon(pts)
+}
+
+func attach(e1, e2 *Edge) {
+	debugDraw(e1, e2)
+	if !place(e1, e2) {
+		return
+	}
 	Splice(e1.Oprev(), e2.Sym())
 	Splice(e1.Sym(), e2.Oprev())
 	DeleteEdge(e2)
@@ -264,17 +515,238 @@ func attach(e1, e2 *Edge) {
 }
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "build" || os.Args[1] == "fold") {
+		run := build
+		if os.Args[1] == "fold" {
+			run = foldCommand
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "manifold: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	flag.StringVar(&outputDir, "out", outputDir, "directory for saved SVG files")
+	paperName := flag.String("paper", "letter", "paper size: "+paperNames())
+	colorFlags(flag.CommandLine, &defaultColors)
+	flag.Parse()
+	paper, err := lookupPaper(*paperName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := defaultColors.check(); err != nil {
+		log.Fatal(err)
+	}
+	defaultPaper = paper
 	http.HandleFunc("/", FrontPage)
 	http.HandleFunc("/compile", Compile)
+	http.HandleFunc("/project", Project)
+	http.HandleFunc("/save", Save)
+	http.HandleFunc("/history", History)
+	http.HandleFunc("/cursor", Cursor)
+	http.HandleFunc("/fold", Fold)
+	http.HandleFunc("/vertices", Vertices)
+	http.HandleFunc("/import", Import)
+	http.HandleFunc("/load", Load)
 	log.Printf("Listening on localhost:1999")
 	log.Fatal(http.ListenAndServe("127.0.0.1:1999", nil))
 }
 
+// build runs a program without the web server and writes the model,
+// ready to print, as SVG:
+//
+//	manifold build -script dodeca.mf -o dodeca.svg -paper a4
+//	manifold build -mesh teapot.obj -o teapot.svg
+//	manifold build -solid truncated-icosahedron -o football.svg
+func build(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	scriptName := flags.String("script", "", "program to run, or - for standard input (the default without -mesh or -solid)")
+	meshFile := flags.String("mesh", "", "OBJ, OFF or STL file to unfold before running the program")
+	solid := flags.String("solid", "", "solid from the catalog to start from, e.g. truncated-icosahedron")
+	outName := flags.String("o", "-", "SVG file to write, or - for standard output")
+	paperName := flags.String("paper", "letter", "paper size: "+paperNames())
+	labels := flags.Bool("labels", true, "label the edges that are glued together")
+	cutName := flags.String("cut", "", "SVG file to write the lines to cut to, by themselves")
+	scoreName := flags.String("score", "", "SVG file to write the folds to score to, by themselves")
+	colors := defaultColors
+	colorFlags(flags, &colors)
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("Unexpected arguments %v", flags.Args())
+	}
+	paper, err := lookupPaper(*paperName)
+	if err != nil {
+		return err
+	}
+	if err := colors.check(); err != nil {
+		return err
+	}
+	m, err := runScript(*scriptName, *meshFile, *solid, paper)
+	if err != nil {
+		return err
+	}
+	m.colors = colors
+	m.foldForPrinting(*labels)
+	for _, layer := range []struct{ name, file string }{{"cut", *cutName}, {"score", *scoreName}} {
+		if layer.file == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(layer.file, m.draw(&options{false, false, false, layer.name}), 0666); err != nil {
+			return err
+		}
+	}
+	out := m.draw(&options{false, false, *labels, ""})
+	if *outName == "-" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return ioutil.WriteFile(*outName, out, 0666)
+}
+
+// foldCommand runs a program without the web server, and reports on the
+// solid that the net folds into, optionally writing it as an OBJ file:
+//
+//	manifold fold -script cube.mf -obj cube.obj
+func foldCommand(args []string) error {
+	flags := flag.NewFlagSet("fold", flag.ExitOnError)
+	scriptName := flags.String("script", "", "program to run, or - for standard input (the default without -mesh or -solid)")
+	meshFile := flags.String("mesh", "", "OBJ, OFF or STL file to unfold before running the program")
+	solid := flags.String("solid", "", "solid from the catalog to start from, e.g. truncated-icosahedron")
+	objName := flags.String("obj", "", "OBJ file to write the folded solid to")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("Unexpected arguments %v", flags.Args())
+	}
+	m, err := runScript(*scriptName, *meshFile, *solid, defaultPaper)
+	if err != nil {
+		return err
+	}
+	if err := m.foldReport(os.Stdout); err != nil {
+		return err
+	}
+	if *objName == "" {
+		return nil
+	}
+	_, folded, err := m.fold()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*objName)
+	if err != nil {
+		return err
+	}
+	if err := folded.WriteOBJ(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runScript makes a new model, starting from the mesh in the file
+// meshFile or the net with tabs of the named solid if either is given,
+// and runs the program in the named file on it.  The program is read
+// from standard input for "-", or for "" when there is no mesh or solid.
+func runScript(name, meshFile, solid string, paper Paper) (*Model, error) {
+	m := NewModel()
+	m.paper = paper
+	switch {
+	case meshFile != "" && solid != "":
+		return nil, fmt.Errorf("Give a mesh or a solid, not both")
+	case meshFile != "":
+		data, err := ioutil.ReadFile(meshFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.importFile(meshFile, data, m.command); err != nil {
+			return nil, err
+		}
+	case solid != "":
+		if err := m.command("solid(" + solid + ")"); err != nil {
+			return nil, err
+		}
+		if err := m.command("T"); err != nil { // the net is still worth having
+			fmt.Fprintf(os.Stderr, "manifold: %s\n", err)
+		}
+	}
+	if name == "" && (meshFile != "" || solid != "") {
+		return m, nil
+	}
+	var prog []byte
+	var err error
+	if name == "-" || name == "" {
+		prog, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		prog, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := m.command(string(prog)); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return m, nil
+}
+
 func FrontPage(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	// Every browser tab gets its own model: a page without a session
+	// token is redirected to one with a fresh token, which the page then
+	// sends back with every request.
+	if req.FormValue("s") == "" {
+		http.Redirect(w, req, "/?s="+newSessionId(), http.StatusFound)
+		return
+	}
 	w.Write(frontPageText)
 	//	frontPage.Execute(w)
 }
 
+// Sessions, one model per browser tab
+var sessions = struct {
+	sync.Mutex
+	models   map[string]*Model
+	lastUsed map[string]time.Time
+}{models: make(map[string]*Model), lastUsed: make(map[string]time.Time)}
+
+var sessionTimeout = 24 * time.Hour
+
+func newSessionId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("can't generate session id")
+	}
+	return hex.EncodeToString(b)
+}
+
+// sessionModel returns the model for the session named in the request,
+// creating it if necessary (e.g., after a server restart).
+func sessionModel(req *http.Request) (*Model, error) {
+	id := req.FormValue("s")
+	if id == "" {
+		return nil, fmt.Errorf("No session")
+	}
+	sessions.Lock()
+	defer sessions.Unlock()
+	now := time.Now()
+	m := sessions.models[id]
+	if m == nil {
+		for old, t := range sessions.lastUsed { // forget abandoned tabs
+			if now.Sub(t) > sessionTimeout {
+				delete(sessions.models, old)
+				delete(sessions.lastUsed, old)
+			}
+		}
+		m = NewModel()
+		sessions.models[id] = m
+	}
+	sessions.lastUsed[id] = now
+	return m, nil
+}
+
 //var frontPage = template.Must(template.New("frontPage").Parse(frontPageText)) // HTML template
 var frontPageText = []byte(`<!doctype html>
 <html>
@@ -289,17 +761,28 @@ body {
 }
 #commands { text-align: center }
 #errors { height: 20pt; color: #c00; text-align: center }
+#status { text-align: center }
+#prefix { color: #c00; font-weight: bold }
+#fold { font-size: 80%; }
+#history { font-family: monospace; font-size: 80%; }
+#history ul { list-style: none; margin: 0; padding-left: 1em; }
+#history a { color: #000; text-decoration: none; }
+#history a.current { color: #fff; background: #c00; }
 </style>
 <script>
 function keyHandler(event) {
 	var e = window.event || event;
+	var target = e.target || e.srcElement;
+	if (target.tagName == "TEXTAREA" || target.tagName == "INPUT") {
+		return true; // typing a program
+	}
 	if (e.keyCode == 66) { // b
-                compile("b");
+                repeat("b");
 		e.preventDefault();
 		return false;
 	}
 	if (e.keyCode == 70) { // f
-                compile("f");
+                repeat("f");
 		e.preventDefault();
 		return false;
 	}
@@ -313,23 +796,70 @@ function keyHandler(event) {
 		e.preventDefault();
 		return false;
 	}
-	if (e.keyCode == 83) { // s
-                compile("s");
+	if (e.keyCode == 83) { // s, S
+		var name = window.prompt(e.shiftKey ? "Save cut and score layers as" : "Save as", saveName);
+		if (name) {
+			saveName = name;
+			save(name, e.shiftKey ? "cut,score" : "");
+		}
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 68) { // d, D
+		var layers = e.shiftKey ? ["cut", "score"] : [""];
+		for (var i = 0; i < layers.length; i++) {
+			var link = document.createElement("a");
+			link.href = "/save?s=" + session + "&download=1&layer=" + layers[i] + "&name=" + encodeURIComponent(saveName);
+			document.body.appendChild(link);
+			link.click();
+			document.body.removeChild(link);
+		}
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 84) { // t, T
+		if (e.shiftKey) {
+			compile("T");
+		} else {
+			repeat("t");
+		}
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 85) { // u, U
+                repeat(e.shiftKey ? "U" : "u");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 86) { // v, V
+                repeat(e.shiftKey ? "V" : "v");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 79) { // o, O
+		if (e.shiftKey) {
+			compile("O");
+		} else {
+			document.getElementById("projectFile").click();
+		}
 		e.preventDefault();
 		return false;
 	}
-	if (e.keyCode == 84) { // t
-                compile("t");
+	if (e.keyCode == 67) { // c
+		var solid = window.prompt("Solid, e.g. truncated-icosahedron, prism-5, tI", "");
+		if (solid) {
+			loadSolid(solid);
+		}
 		e.preventDefault();
 		return false;
 	}
-	if (e.keyCode == 85) { // u
-                compile("u");
+	if (e.keyCode == 73) { // i
+		document.getElementById("meshFile").click();
 		e.preventDefault();
 		return false;
 	}
-	if (e.keyCode == 86) { // v
-                compile("v");
+	if (e.keyCode == 87) { // w
+		window.location = "/project?s=" + session;
 		e.preventDefault();
 		return false;
 	}
@@ -338,22 +868,206 @@ function keyHandler(event) {
 		e.preventDefault();
 		return false;
 	}
-	if (51 <= e.keyCode && e.keyCode <= 57) { // 3-9
-                compile(String.fromCharCode(e.keyCode));
+	if (48 <= e.keyCode && e.keyCode <= 57) { // 0-9
+		var digit = String.fromCharCode(e.keyCode);
+		if (prefix != null) {
+			setPrefix(prefix + digit);
+		} else if (digit >= "3") {
+			compile(digit); // 3-9 attach a polygon right away
+		}
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 13) { // Enter: polygon with prefix sides, or accept the previewed polygon
+		compile(prefix ? prefix : "a");
+		setPrefix(null);
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 8 && prefix != null) { // Backspace
+		setPrefix(prefix != "" ? prefix.slice(0, -1) : null);
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 27) { // Escape
+		if (prefix == null) {
+			compile("k");
+		}
+		setPrefix(null);
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 80) { // p
+		compile("p");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 69) { // e, E
+		repeat(e.shiftKey ? "E" : "e");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 88) { // x
+		compile("x");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 76) { // l
+		compile("l");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 71) { // g, G
+		showReport(e.shiftKey ? "/vertices" : "/fold");
+		e.preventDefault();
+		return false;
+	}
+	if (e.keyCode == 78) { // n
+		setPrefix("");
 		e.preventDefault();
 		return false;
 	}
         return true;
 }
+// A number typed after n is a count for the next command, or, followed
+// by Enter or a click, the number of sides of a polygon.  Without the n,
+// 3-9 attach a polygon right away.  prefix is null when there is no n.
+var prefix = null;
+function setPrefix(p) {
+	prefix = p;
+	document.getElementById("prefix").innerHTML = p == null ? "" : "n" + p;
+}
+function repeat(cmd) {
+	compile(cmd + (prefix || ""));
+	setPrefix(null);
+}
+var session = (/[?&]s=([^&]*)/.exec(window.location.search) || [null, ""])[1];
 var xmlreq;
 function compile(prog) {
 	var req = new XMLHttpRequest();
 	xmlreq = req;
 	req.onreadystatechange = compileUpdate;
-	req.open("POST", "/compile", true);
+	req.open("POST", "/compile?s=" + session, true);
 	req.setRequestHeader("Content-Type", "text/plain; charset=utf-8");
 	req.send(prog);
 }
+var saveName = "hello.svg";
+function save(name, layer) {
+	var req = new XMLHttpRequest();
+	req.onreadystatechange = function() {
+		if (req.readyState != 4) {
+			return;
+		}
+		if (req.status == 200) {
+			document.getElementById("status").innerHTML = req.responseText;
+			document.getElementById("errors").innerHTML = "";
+		} else {
+			document.getElementById("status").innerHTML = "";
+			document.getElementById("errors").innerHTML = req.responseText;
+		}
+	};
+	req.open("POST", "/save?s=" + session + "&layer=" + layer + "&name=" + encodeURIComponent(name), true);
+	req.send();
+}
+function openProject(input) {
+	if (input.files.length == 0) {
+		return;
+	}
+	var reader = new FileReader();
+	reader.onload = function() {
+		var req = new XMLHttpRequest();
+		xmlreq = req;
+		req.onreadystatechange = compileUpdate;
+		req.open("POST", "/project?s=" + session, true);
+		req.setRequestHeader("Content-Type", "application/json");
+		req.send(reader.result);
+	};
+	reader.readAsText(input.files[0]);
+	input.value = "";
+}
+function loadSolid(solid) {
+	var req = new XMLHttpRequest();
+	xmlreq = req;
+	req.onreadystatechange = compileUpdate;
+	req.open("POST", "/load?s=" + session + "&solid=" + encodeURIComponent(solid), true);
+	req.send();
+}
+function start() {
+	var solid = /[?&]solid=([^&]*)/.exec(window.location.search);
+	if (solid) {
+		loadSolid(decodeURIComponent(solid[1].replace(/\+/g, " ")));
+	} else {
+		compile("z");
+	}
+}
+function importMesh(input) {
+	if (input.files.length == 0) {
+		return;
+	}
+	var req = new XMLHttpRequest();
+	xmlreq = req;
+	req.onreadystatechange = compileUpdate;
+	req.open("POST", "/import?s=" + session + "&name=" + encodeURIComponent(input.files[0].name), true);
+	req.send(input.files[0]);
+	input.value = "";
+}
+function clickEdge(event) {
+	var e = window.event || event;
+	var target = e.target || e.srcElement;
+	var fold = /^fold-([0-9]+)$/.exec(target.id || "");
+	if (fold) {
+		compile("crease(" + fold[1] + ")");
+		return;
+	}
+	var match = /^edge-([0-9]+)$/.exec(target.id || "");
+	if (!match) {
+		return;
+	}
+	var req = new XMLHttpRequest();
+	xmlreq = req;
+	req.onreadystatechange = compileUpdate;
+	req.open("POST", "/cursor?s=" + session + "&edge=" + match[1] + "&sides=" + (prefix || ""), true);
+	req.send();
+	setPrefix(null);
+}
+function runProgram() {
+	compile(document.getElementById("programText").value);
+}
+function jump(node) {
+	var req = new XMLHttpRequest();
+	xmlreq = req;
+	req.onreadystatechange = compileUpdate;
+	req.open("POST", "/history?s=" + session + "&node=" + node, true);
+	req.send();
+	return false;
+}
+function showHistory() {
+	var req = new XMLHttpRequest();
+	req.onreadystatechange = function() {
+		if (req.readyState == 4 && req.status == 200) {
+			document.getElementById("history").innerHTML = req.responseText;
+		}
+	};
+	req.open("GET", "/history?s=" + session, true);
+	req.send();
+}
+function showReport(path) {
+	var req = new XMLHttpRequest();
+	req.onreadystatechange = function() {
+		if (req.readyState != 4) {
+			return;
+		}
+		if (req.status == 200) {
+			document.getElementById("fold").textContent = req.responseText;
+			document.getElementById("errors").innerHTML = "";
+		} else {
+			document.getElementById("fold").textContent = "";
+			document.getElementById("errors").innerHTML = req.responseText;
+		}
+	};
+	req.open("GET", path + "?s=" + session, true);
+	req.send();
+}
 function compileUpdate() {
 	var req = xmlreq;
 	if(!req || req.readyState != 4) {
@@ -365,190 +1079,2231 @@ function compileUpdate() {
 	} else {
 		document.getElementById("errors").innerHTML = req.responseText;
 	}
+	showHistory();
+	document.getElementById("fold").textContent = "";
 }
 </script>
 </head>
-<body onload='compile("z")' onkeydown="keyHandler(event);">
-<div id="commands">3&ndash;9: polygon, f: forward, b: back, r: reverse, s: save, t: tab, u: undo, z: zero, m: maximize toggle</div>
+<body onload='start()' onkeydown="keyHandler(event);">
+<div id="commands"><span id="prefix"></span> 3&ndash;9: polygon, n and a number: polygon with that many sides (then Enter) or count (then f, b, t, u, U, v, V, e or E), f: forward, b: back, r: reverse, s: save as, S: save cut and score layers, d: download, D: download cut and score layers, t: tab, T: tabs for folding, u: undo, U: redo, z: zero, m: maximize toggle, p: preview toggle, O: split overlaps into pieces toggle, e/E: attach by next/previous edge, x: mirror, Enter: accept, Esc: cancel, click: move cursor (after n and a number: attach polygon) or turn fold over, V: printed side inside toggle, w: write project, o: open project, g: fold, G: vertex angles, l: gluing labels toggle, i: import OBJ/OFF/STL mesh, c: solid from catalog</div>
+<input type="file" id="projectFile" accept=".manifold" style="display:none" onchange="openProject(this)">
+<input type="file" id="meshFile" accept=".obj,.off,.stl" style="display:none" onchange="importMesh(this)">
+<div id="status"></div>
 <div id="errors"></div>
-<div id="output" align="center"></div>
+<div id="output" align="center" onclick="clickEdge(event)"></div>
+<pre id="fold"></pre>
+<div id="history"></div>
+<div id="program" align="center">
+<textarea id="programText" rows="4" cols="60" placeholder="Program, e.g. (4 f)x4 t*"></textarea><br>
+<button onclick="runProgram()">Run program</button>
+</div>
 </body>
 </html>
 `)
 
-var e0 *Edge         // "current" edge, on perimeter in CCW direction in coordinate system with Y coordinates up
-var reversed = false // whether arrow on current edge is draw source->target or target->source
-var internal = make(map[*QuadEdge]bool)
-var tabEdge = make(map[*QuadEdge]bool)
-var maximize = false
-var history = new(bytes.Buffer)
+// A Model is a paper net under construction, together with the editing
+// state that goes with it.  The web server keeps one model per session;
+// the mutex must be held while a model is read or changed.
+type Model struct {
+	mu       sync.Mutex
+	root     *Edge // first edge of the first polygon; edges are numbered by traversal from here
+	e0       *Edge // "current" edge, on perimeter in CCW direction in coordinate system with Y coordinates up
+	reversed bool  // whether arrow on current edge is draw source->target or target->source
+	internal map[*QuadEdge]bool
+	tabEdge  map[*QuadEdge]bool
+	maximize bool
+	paper    Paper
+	colors   Colors
 
-func attachAndMove(e1 *Edge) {
-	if e0 == nil {
-		e0 = e1
-		return
-	}
-	internal[e0.Q] = true
-	eNext := forwardSkipTabs(e0)
-	attach(e0, e1)
-	if *eNext == *e0 {
-		eNext = e0.Oprev()
-	}
-	e0 = eNext
-}
+	// New tabs are in tabStyle unless given a style of their own.
+	// slots holds the edges with tabs that lock into a slit in the
+	// edge they are glued to, with the distance of the slit from that
+	// edge as a fraction of its length.
+	tabStyle TabStyle
+	slots    map[*QuadEdge]float64
 
-func ccwPerimeter(e *Edge) *Edge {
-	return e.Rprev()
-}
+	// Folds are mountain folds, seen from the printed side of the net,
+	// except for the edges in valleys, which are reflex edges of an
+	// imported mesh.  Every fold turns the other way if inward, when
+	// the printed side goes inside, and each fold in creased turns the
+	// other way again.
+	valleys map[*QuadEdge]bool
+	creased map[*QuadEdge]bool
+	inward  bool
 
-func cwPerimeter(e *Edge) *Edge {
-	return e.Rnext()
-}
+	// Gluing labels are shown unless hidden.  Folding takes a while, so
+	// it is only done when asked for, and glue keeps the edges glued
+	// together for the net that was folded last.
+	hideLabels bool
+	glue       *gluing
 
-func backward(e *Edge) *Edge {
-	if reversed {
-		return ccwPerimeter(e)
-	} else {
-		return cwPerimeter(e)
-	}
-}
+	// Meshes that have been imported, by name, for import(name) in the
+	// history.
+	meshes map[string]*mesh.Mesh
 
-func forward(e *Edge) *Edge {
-	if reversed {
-		return cwPerimeter(e)
-	} else {
-		return ccwPerimeter(e)
-	}
+	// In preview mode, a polygon from the keyboard is shown at the
+	// cursor but not attached until it is accepted, so that the edge it
+	// is attached by can be chosen first.
+	preview bool
+	pending *script.Command
+
+	// In split mode, a polygon that would overlap the net starts a
+	// new piece beside it instead.  pieces holds the first edge of each
+	// piece after the first, and splits the pairs of edges, one on
+	// each side of a split, that are glued together.
+	split  bool
+	pieces []*Edge
+	splits [][2]*Edge
+
+	// Polygons from the browser's keys and clicks, one command at a
+	// time, that would overlap the net are refused.  Programs are run
+	// as they are, since a net that overlaps can still be printed in
+	// pieces.
+	checkOverlaps bool
+
+	undoRoot  *undoNode // the empty history
+	current   *undoNode // the history that built the model
+	undoNodes map[int]*undoNode
+	replaying bool // don't record commands while replaying history
 }
 
-func backwardSkipTabs(e *Edge) *Edge {
-	e1 := backward(e)
-	for tabEdge[e1.Q] && *e1 != *e {
-		e1 = backward(e1)
-	}
-	return e1
+// The undo tree.  Each node is a command; the history of a model is the
+// path of commands from the root to the model's current node.  Undoing a
+// command moves to the parent node, and a new command after an undo
+// starts a new branch, so no history is ever lost.
+type undoNode struct {
+	id       int
+	cmd      string
+	parent   *undoNode
+	children []*undoNode
+	redo     *undoNode // child to move to on redo: the one most recently left
+	depth    int       // number of commands from the root
+	snap     *snapshot // copy of the model at this node, if any
 }
 
-func forwardSkipTabs(e *Edge) *Edge {
-	e1 := forward(e)
-	for tabEdge[e1.Q] && *e1 != *e {
-		e1 = forward(e1)
-	}
-	return e1
+// Replaying a long history from scratch is slow, so every
+// snapshotInterval commands along each branch the undo tree keeps a copy
+// of the model.  Moving to a node then replays at most snapshotInterval-1
+// commands, starting from the nearest snapshot above it.
+var snapshotInterval = 16
+
+type snapshot struct {
+	root, e0                  *Edge
+	pieces                    []*Edge
+	splits                    [][2]*Edge
+	internal, tabEdge         map[*QuadEdge]bool
+	slots                     map[*QuadEdge]float64
+	valleys, creased          map[*QuadEdge]bool
+	reversed, maximize, split bool
+	inward                    bool
+	tabStyle                  TabStyle
 }
 
-func command(cmd string) error {
-	switch string(cmd) {
-	case "3":
-		attachAndMove(Ngon(3, documentPolygonSide))
-	case "4":
-		attachAndMove(Ngon(4, documentPolygonSide))
-	case "5":
-		attachAndMove(Ngon(5, documentPolygonSide))
-	case "6":
-		attachAndMove(Ngon(6, documentPolygonSide))
-	case "7":
-		attachAndMove(Ngon(7, documentPolygonSide))
-	case "8":
-		attachAndMove(Ngon(8, documentPolygonSide))
-	case "9":
-		attachAndMove(Ngon(9, documentPolygonSide))
-	case "b":
-		if e0 == nil {
-			return nil
+// copyNet copies the net, every piece of it, and the edge maps that go
+// with it.
+func copyNet(s *snapshot) *snapshot {
+	c := &snapshot{
+		internal: make(map[*QuadEdge]bool),
+		tabEdge:  make(map[*QuadEdge]bool),
+		slots:    make(map[*QuadEdge]float64),
+		valleys:  make(map[*QuadEdge]bool),
+		creased:  make(map[*QuadEdge]bool),
+		reversed: s.reversed,
+		maximize: s.maximize,
+		split:    s.split,
+		inward:   s.inward,
+		tabStyle: s.tabStyle,
+	}
+	if s.root == nil {
+		return c
+	}
+	copies := make(map[*QuadEdge]*QuadEdge)
+	for _, r := range append([]*Edge{s.root}, s.pieces...) {
+		_, cs := Clone(r)
+		for q, qc := range cs {
+			copies[q] = qc
 		}
-		e0 = backwardSkipTabs(e0)
-	case "f":
-		if e0 == nil {
+	}
+	copyEdge := func(e *Edge) *Edge {
+		return &Edge{copies[e.Q], e.R}
+	}
+	c.root = copyEdge(s.root)
+	c.e0 = copyEdge(s.e0)
+	for _, r := range s.pieces {
+		c.pieces = append(c.pieces, copyEdge(r))
+	}
+	for _, p := range s.splits {
+		c.splits = append(c.splits, [2]*Edge{copyEdge(p[0]), copyEdge(p[1])})
+	}
+	for q, qc := range copies {
+		if s.internal[q] {
+			c.internal[qc] = true
+		}
+		if s.tabEdge[q] {
+			c.tabEdge[qc] = true
+		}
+		if d, ok := s.slots[q]; ok {
+			c.slots[qc] = d
+		}
+		if s.valleys[q] {
+			c.valleys[qc] = true
+		}
+		if s.creased[q] {
+			c.creased[qc] = true
+		}
+	}
+	return c
+}
+
+func (m *Model) snapshot() *snapshot {
+	return copyNet(&snapshot{
+		root:     m.root,
+		e0:       m.e0,
+		pieces:   m.pieces,
+		splits:   m.splits,
+		internal: m.internal,
+		tabEdge:  m.tabEdge,
+		slots:    m.slots,
+		valleys:  m.valleys,
+		creased:  m.creased,
+		reversed: m.reversed,
+		maximize: m.maximize,
+		split:    m.split,
+		inward:   m.inward,
+		tabStyle: m.tabStyle,
+	})
+}
+
+func (m *Model) loadSnapshot(s *snapshot) {
+	// copy again so that the snapshot itself is never changed
+	c := copyNet(s)
+	m.root, m.e0, m.pieces, m.splits = c.root, c.e0, c.pieces, c.splits
+	m.internal, m.tabEdge, m.slots = c.internal, c.tabEdge, c.slots
+	m.valleys, m.creased = c.valleys, c.creased
+	m.reversed = c.reversed
+	m.maximize = c.maximize
+	m.split = c.split
+	m.inward = c.inward
+	m.tabStyle = c.tabStyle
+}
+
+// history returns the program that built the model.
+func (m *Model) history() string {
+	return strings.Join(m.current.path(), " ")
+}
+
+func (n *undoNode) path() []string {
+	if n.parent == nil {
+		return nil
+	}
+	return append(n.parent.path(), n.cmd)
+}
+
+// record adds cmd to the history.  If cmd was undone earlier, the branch
+// containing it is reused instead of adding a duplicate.
+func (m *Model) record(cmd string) {
+	if m.replaying {
+		return
+	}
+	for _, child := range m.current.children {
+		if child.cmd == cmd {
+			m.current.redo = child
+			m.current = child
+			return
+		}
+	}
+	n := &undoNode{id: len(m.undoNodes), cmd: cmd, parent: m.current, depth: m.current.depth + 1}
+	if n.depth%snapshotInterval == 0 {
+		n.snap = m.snapshot()
+	}
+	m.undoNodes[n.id] = n
+	m.current.children = append(m.current.children, n)
+	m.current.redo = n
+	m.current = n
+}
+
+// clear empties the net, without touching the undo tree.
+func (m *Model) clear() {
+	m.pending = nil
+	m.root = nil
+	m.e0 = nil
+	m.internal = make(map[*QuadEdge]bool)
+	m.tabEdge = make(map[*QuadEdge]bool)
+	m.slots = make(map[*QuadEdge]float64)
+	m.tabStyle = defaultTabStyle
+	m.valleys = make(map[*QuadEdge]bool)
+	m.creased = make(map[*QuadEdge]bool)
+	m.inward = false
+	m.reversed = false
+	m.maximize = false
+	m.split = false
+	m.pieces = nil
+	m.splits = nil
+}
+
+// restore rebuilds the model as it was at node n, from the nearest
+// snapshot at or above n.
+func (m *Model) restore(n *undoNode) error {
+	for p := n; p.parent != nil; p = p.parent {
+		p.parent.redo = p // redo retraces the path we're moving to
+	}
+	var path []*undoNode
+	start := n
+	for ; start.parent != nil && start.snap == nil; start = start.parent {
+		path = append(path, start)
+	}
+	if start.snap != nil {
+		m.loadSnapshot(start.snap)
+	} else {
+		m.clear()
+	}
+	m.replaying = true
+	defer func() { m.replaying = false }()
+	for i := len(path) - 1; i >= 0; i-- {
+		if err := m.command(path[i].cmd); err != nil {
+			return err
+		}
+	}
+	m.current = n
+	return nil
+}
+
+func (m *Model) undo() error {
+	if m.current.parent == nil {
+		return nil // nothing to undo
+	}
+	return m.restore(m.current.parent)
+}
+
+func (m *Model) redo() error {
+	if m.current.redo == nil {
+		return nil // nothing to redo
+	}
+	return m.restore(m.current.redo)
+}
+
+// undoTree writes the undo tree as nested HTML lists.  Each command
+// links to the node it leads to; the current node is highlighted.
+func (m *Model) undoTree(buf *bytes.Buffer) {
+	var branch func(n *undoNode)
+	branch = func(n *undoNode) {
+		for {
+			class := ""
+			if n == m.current {
+				class = " class='current'"
+			}
+			label := html.EscapeString(n.cmd)
+			if n.parent == nil {
+				label = "&#8709;" // empty set
+			}
+			fmt.Fprintf(buf, "<a href='#' onclick='return jump(%d)'%s>%s</a> ", n.id, class, label)
+			if len(n.children) != 1 {
+				break
+			}
+			n = n.children[0]
+		}
+		if len(n.children) == 0 {
+			return
+		}
+		fmt.Fprintf(buf, "<ul>")
+		for _, child := range n.children {
+			fmt.Fprintf(buf, "<li>")
+			branch(child)
+			fmt.Fprintf(buf, "</li>")
+		}
+		fmt.Fprintf(buf, "</ul>")
+	}
+	fmt.Fprintf(buf, "<ul><li>")
+	branch(m.undoRoot)
+	fmt.Fprintf(buf, "</li></ul>")
+}
+
+func NewModel() *Model {
+	m := new(Model)
+	m.paper = defaultPaper
+	m.colors = defaultColors
+	m.meshes = make(map[string]*mesh.Mesh)
+	m.command("z")
+	return m
+}
+
+// edges returns all of the edges of the model, numbered consistently
+// for models built by the same history: the first piece of the net,
+// then each piece split off from it in turn.
+func (m *Model) edges() map[int]*Edge {
+	edges := make(map[int]*Edge)
+	if m.root == nil {
+		return edges
+	}
+	for _, r := range append([]*Edge{m.root}, m.pieces...) {
+		n := len(edges)
+		for i, e := range r.Edges() {
+			edges[n+i] = e
+		}
+	}
+	return edges
+}
+
+// perimeterEdge returns an edge of the perimeter of the piece of the
+// net that e is on, with the piece on its left.  The outside is the
+// only face whose corners go clockwise.
+func perimeterEdge(e *Edge) *Edge {
+	edges := e.Edges()
+	for i := 0; i < len(edges); i++ {
+		for _, e2 := range []*Edge{edges[i], edges[i].Sym()} {
+			if geom.Area(points(e2)) < 0 {
+				return e2.Sym()
+			}
+		}
+	}
+	return e
+}
+
+// outlines returns an edge of the perimeter of each piece of the net,
+// with the piece on its left; for the piece the cursor is on, the
+// cursor.
+func (m *Model) outlines() []*Edge {
+	if m.root == nil {
+		return nil
+	}
+	var outlines []*Edge
+	for _, r := range append([]*Edge{m.root}, m.pieces...) {
+		e := perimeterEdge(r)
+		for _, e1 := range r.Edges() {
+			if e1.Q == m.e0.Q {
+				e = m.e0
+				break
+			}
+		}
+		outlines = append(outlines, e)
+	}
+	return outlines
+}
+
+// boundingBox returns the corners of a box around every piece of the
+// net.
+func (m *Model) boundingBox() (small, big *Point2D) {
+	for _, r := range append([]*Edge{m.root}, m.pieces...) {
+		s, b := BoundingBox(r)
+		if small == nil {
+			small, big = s, b
+			continue
+		}
+		small = &Point2D{math.Min(small.X, s.X), math.Min(small.Y, s.Y)}
+		big = &Point2D{math.Max(big.X, b.X), math.Max(big.Y, b.Y)}
+	}
+	return small, big
+}
+
+// splitOff starts a new piece with the polygon of p, which is placed at
+// the cursor but would overlap the net there.  The new piece goes to
+// the right of the rest of the net, and the cursor moves on as if the
+// polygon had been attached.
+func (m *Model) splitOff(p *Edge) {
+	small, big := m.boundingBox()
+	psmall, _ := BoundingBox(p)
+	translate(p, big.X+m.paper.PolygonSide/2-psmall.X, small.Y-psmall.Y)
+	m.pieces = append(m.pieces, p)
+	m.splits = append(m.splits, [2]*Edge{m.e0, p})
+	m.e0 = m.forwardSkipTabs(m.e0)
+}
+
+func (m *Model) attachAndMove(e1 *Edge) {
+	if m.e0 == nil {
+		m.root = e1
+		m.e0 = e1
+		return
+	}
+	m.internal[m.e0.Q] = true
+	eNext := m.forwardSkipTabs(m.e0)
+	attach(m.e0, e1)
+	if *eNext == *m.e0 {
+		eNext = m.e0.Oprev()
+	}
+	m.e0 = eNext
+}
+
+func ccwPerimeter(e *Edge) *Edge {
+	return e.Rprev()
+}
+
+func cwPerimeter(e *Edge) *Edge {
+	return e.Rnext()
+}
+
+func (m *Model) backward(e *Edge) *Edge {
+	if m.reversed {
+		return ccwPerimeter(e)
+	} else {
+		return cwPerimeter(e)
+	}
+}
+
+func (m *Model) forward(e *Edge) *Edge {
+	if m.reversed {
+		return cwPerimeter(e)
+	} else {
+		return ccwPerimeter(e)
+	}
+}
+
+func (m *Model) backwardSkipTabs(e *Edge) *Edge {
+	e1 := m.backward(e)
+	for m.tabEdge[e1.Q] && *e1 != *e {
+		e1 = m.backward(e1)
+	}
+	return e1
+}
+
+func (m *Model) forwardSkipTabs(e *Edge) *Edge {
+	e1 := m.forward(e)
+	for m.tabEdge[e1.Q] && *e1 != *e {
+		e1 = m.forward(e1)
+	}
+	return e1
+}
+
+// command runs a program (see package script).  Each command in the
+// program that changes the model is added to the history.
+func (m *Model) command(prog string) error {
+	cmds, err := script.Parse(prog)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if err := m.execute(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Model) execute(cmd script.Command) error {
+	if cmd.Args != nil && cmd.Op != "t" && (cmd.Count != 0 || cmd.All) {
+		return fmt.Errorf("%s can't be repeated", cmd) // only t takes a count with arguments
+	}
+	if isPolygon(cmd) {
+		p, err := m.polygon(cmd)
+		if err != nil {
+			return err
+		}
+		// In split mode polygons are checked even when replaying,
+		// so that the history builds the same pieces again
+		if (m.split || m.checkOverlaps && !m.replaying) && m.e0 != nil && place(m.e0, p) && len(m.overlaps(p)) > 0 {
+			if !m.split {
+				return fmt.Errorf("%s would overlap the net", cmd)
+			}
+			m.splitOff(p)
+			m.record(cmd.String())
+			return nil
+		}
+		m.attachAndMove(p)
+		m.record(cmd.String())
+		return nil
+	}
+	if cmd.Op == "edge" && cmd.Args != nil {
+		return m.moveCursor(cmd)
+	}
+	if (cmd.Op == "import" || cmd.Op == "solid") && cmd.Args != nil {
+		return m.importMesh(cmd)
+	}
+	if cmd.Op == "crease" && cmd.Args != nil {
+		return m.crease(cmd)
+	}
+	if cmd.Op == "tabs" && cmd.Args != nil {
+		style := defaultTabStyle
+		if len(cmd.Args) > 0 {
+			var err error
+			if style, err = m.parseTabStyle(cmd); err != nil {
+				return err
+			}
+		}
+		m.tabStyle = style
+		m.record(cmd.String())
+		return nil
+	}
+	if cmd.All && cmd.Op != "t" || cmd.Args != nil && cmd.Op != "t" || cmd.Edge != 0 {
+		return fmt.Errorf("Unknown command %s", cmd)
+	}
+	n := cmd.Times()
+	switch cmd.Op {
+	case "b":
+		if m.e0 == nil {
+			return nil
+		}
+		for i := 0; i < n; i++ {
+			m.e0 = m.backwardSkipTabs(m.e0)
+		}
+	case "f":
+		if m.e0 == nil {
+			return nil
+		}
+		for i := 0; i < n; i++ {
+			m.e0 = m.forwardSkipTabs(m.e0)
+		}
+	case "a":
+		if m.pending == nil {
 			return nil
 		}
-		e0 = forwardSkipTabs(e0)
+		cmd := *m.pending
+		m.pending = nil
+		if err := m.execute(cmd); err != nil {
+			m.pending = &cmd // so that it can be attached another way
+			return err
+		}
+		return nil
+	case "e", "E":
+		if m.pending == nil {
+			return nil
+		}
+		p, err := m.polygon(*m.pending)
+		if err != nil {
+			return err
+		}
+		if cmd.Op == "E" {
+			n = -n
+		}
+		k := sides(p)
+		m.pending.Edge = ((m.pending.Edge+n)%k + k) % k
+		return nil // don't add "e" to command history
+	case "k":
+		m.pending = nil
+		return nil // don't add "k" to command history
+	case "l":
+		for i := 0; i < n; i++ {
+			m.hideLabels = !m.hideLabels
+		}
+		return nil // don't add "l" to command history
 	case "m":
-		maximize = !maximize
+		for i := 0; i < n; i++ {
+			m.maximize = !m.maximize
+		}
+	case "O":
+		for i := 0; i < n; i++ {
+			m.split = !m.split
+		}
+	case "V":
+		for i := 0; i < n; i++ {
+			m.inward = !m.inward
+		}
+	case "p":
+		m.preview = !m.preview
+		m.pending = nil
+		return nil // don't add "p" to command history
+	case "x":
+		if m.pending != nil {
+			m.pending.Flip = !m.pending.Flip
+		}
+		return nil // don't add "x" to command history
 	case "r":
-		reversed = !reversed
+		for i := 0; i < n; i++ {
+			m.reversed = !m.reversed
+		}
 	case "s":
-		file, err := os.Create("hello.svg")
+		_, err := m.save(defaultSaveName, "")
+		return err // don't add "s" to command history
+	case "t":
+		if m.e0 == nil {
+			return nil
+		}
+		if cmd.All {
+			n = len(m.perimeter())
+		}
+		style := m.tabStyle
+		if cmd.Args != nil {
+			var err error
+			if style, err = m.parseTabStyle(cmd); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < n; i++ {
+			if !m.tabEdge[m.e0.Q] { // e0 can be a tab edge if entire perimeter is tabs; don't attach a tab to a tab
+				fitted, fits := m.fitTab(m.e0, style, m.polygons())
+				if !fits {
+					if cmd.Args == nil {
+						return fmt.Errorf("No tab fits there without overlapping the net; give t a style, as in t(plain), to add one anyway")
+					}
+					fitted = style // the user asked for this tab
+				}
+				m.addTab(fitted)
+			}
+		}
+	case "T":
+		if err := m.autoTabs(); err != nil {
+			return err
+		}
+	case "u":
+		for i := 0; i < n; i++ {
+			if err := m.undo(); err != nil {
+				return err
+			}
+		}
+		return nil // don't add "u" to command history
+	case "U":
+		for i := 0; i < n; i++ {
+			if err := m.redo(); err != nil {
+				return err
+			}
+		}
+		return nil // don't add "U" to command history
+	case "v":
+		if m.e0 == nil {
+			return nil
+		}
+		for i := 0; i < n; i++ {
+			if !m.tabEdge[m.e0.Q] { // e0 can be a tab edge if entire perimeter is tabs; don't attach a tab to a tab
+				m.attachAndMove(traySide())
+			}
+		}
+	case "z":
+		m.clear()
+		m.undoRoot = &undoNode{}
+		m.current = m.undoRoot
+		m.undoNodes = map[int]*undoNode{0: m.undoRoot}
+		return nil // don't add "z" to (now empty) command history
+	default:
+		return fmt.Errorf("Unknown command %s", cmd) // don't add errors to command history
+	}
+	m.record(cmd.String())
+	return nil
+}
+
+func isPolygon(cmd script.Command) bool {
+	return cmd.Sides != 0 || cmd.Args != nil && shapes[cmd.Op] != nil
+}
+
+// interactive runs a program from the browser.  A single command comes
+// from a key or a click, so a polygon that would overlap the net is
+// refused, and in preview mode a single polygon becomes the pending
+// polygon instead of being attached.  A click that attaches a polygon
+// runs edge(i) and then the polygon, which counts as a single command
+// too.  A program that fails leaves the model as it was.
+func (m *Model) interactive(prog string) error {
+	cmds, err := script.Parse(prog)
+	if err != nil {
+		return err
+	}
+	single := len(cmds) == 1 || len(cmds) == 2 && cmds[0].Op == "edge"
+	if single {
+		m.checkOverlaps = true
+		defer func() { m.checkOverlaps = false }()
+	}
+	rollback := m.checkpoint()
+	for i, cmd := range cmds {
+		if single && i == len(cmds)-1 && m.preview && m.e0 != nil && isPolygon(cmd) {
+			if _, err = m.polygon(cmd); err == nil {
+				m.pending = &cmds[i]
+			}
+		} else {
+			err = m.execute(cmd)
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpoint returns a function that puts the model back as it is now,
+// undo tree and all, for changes that fail halfway.  Commands recorded
+// since are forgotten, and the net is rebuilt as for undo.
+func (m *Model) checkpoint() func() {
+	undoRoot, current, undoNodes, redo := m.undoRoot, m.current, m.undoNodes, m.current.redo
+	paper, colors, meshes := m.paper, m.colors, m.meshes
+	hideLabels, preview, pending := m.hideLabels, m.preview, m.pending
+	n := len(m.undoNodes) // nodes are numbered in order
+	return func() {
+		m.hideLabels, m.preview, m.pending = hideLabels, preview, pending
+		if m.undoRoot == undoRoot && m.current == current && len(undoNodes) == n {
+			return // nothing was recorded, so nothing changed
+		}
+		for id, node := range undoNodes {
+			if id >= n {
+				delete(undoNodes, id)
+				continue
+			}
+			children := node.children[:0]
+			for _, child := range node.children {
+				if child.id < n {
+					children = append(children, child)
+				}
+			}
+			node.children = children
+			if node.redo != nil && node.redo.id >= n {
+				node.redo = nil
+			}
+		}
+		m.undoRoot, m.current, m.undoNodes = undoRoot, current, undoNodes
+		m.paper, m.colors, m.meshes = paper, colors, meshes
+		m.restore(current)
+		current.redo = redo
+	}
+}
+
+// Polygons with more sides than this are indistinguishable from circles
+// and are almost certainly typos.
+var maxSides = 360
+
+// Irregular polygons by name, for commands like rect(2).  Each returns
+// the sides and angles for TurtlePolygon; lengths are relative to the
+// side of a regular polygon, and angles are in degrees.
+var shapes = map[string]func(args []float64) (sides, angles []float64, err error){
+	// rect(h): rectangle of width 1 and height h
+	"rect": func(args []float64) ([]float64, []float64, error) {
+		if len(args) != 1 {
+			return nil, nil, fmt.Errorf("rect takes a height")
+		}
+		h := args[0]
+		return []float64{1, h, 1}, []float64{90, 90}, nil
+	},
+	// iso(apex): isosceles triangle with base 1 and the given apex angle
+	"iso": func(args []float64) ([]float64, []float64, error) {
+		if len(args) != 1 || args[0] <= 0 || args[0] >= 180 {
+			return nil, nil, fmt.Errorf("iso takes an apex angle between 0 and 180")
+		}
+		apex := args[0] / 180 * math.Pi
+		leg := 0.5 / math.Sin(apex/2)
+		return []float64{1, leg}, []float64{(180 - args[0]) / 2}, nil
+	},
+	// rhombus(a): rhombus with sides 1 and an angle a at the first vertex
+	"rhombus": func(args []float64) ([]float64, []float64, error) {
+		if len(args) != 1 || args[0] <= 0 || args[0] >= 180 {
+			return nil, nil, fmt.Errorf("rhombus takes an angle between 0 and 180")
+		}
+		a := args[0]
+		return []float64{1, 1, 1}, []float64{180 - a, a}, nil
+	},
+	// kite(a, b): kite with angle a between its two sides of length 1,
+	// and angle b between its two longer (or shorter) sides
+	"kite": func(args []float64) ([]float64, []float64, error) {
+		if len(args) != 2 || args[0] <= 0 || args[1] <= 0 || args[0]+args[1] >= 360 {
+			return nil, nil, fmt.Errorf("kite takes two angles")
+		}
+		a := args[0] / 180 * math.Pi
+		b := args[1] / 180 * math.Pi
+		l := math.Sin(a/2) / math.Sin(b/2)
+		side := (360 - args[0] - args[1]) / 2
+		return []float64{1, l, l}, []float64{side, args[1]}, nil
+	},
+	// poly(s1, a1, s2, a2, ..., sn): sides and the angles between them,
+	// closed by one more side
+	"poly": func(args []float64) ([]float64, []float64, error) {
+		if len(args) < 3 || len(args)%2 == 0 {
+			return nil, nil, fmt.Errorf("poly takes sides and the angles between them, starting and ending with a side")
+		}
+		var sides, angles []float64
+		for i, arg := range args {
+			if i%2 == 0 {
+				sides = append(sides, arg)
+			} else {
+				angles = append(angles, arg)
+			}
+		}
+		return sides, angles, nil
+	},
+}
+
+// The commands with arguments, so that programs can leave out the space
+// between them and single-letter commands: "ftrect(2)" is "f t rect(2)".
+func init() {
+	for name := range shapes {
+		script.Functions[name] = true
+	}
+	for _, name := range []string{"t", "tabs", "edge", "crease", "import", "solid"} {
+		script.Functions[name] = true
+	}
+}
+
+// polygon makes the polygon for a polygon command, returning the edge it
+// is to be attached by.
+func (m *Model) polygon(cmd script.Command) (*Edge, error) {
+	var p *Edge
+	if cmd.Sides != 0 {
+		if cmd.Sides < 3 {
+			return nil, fmt.Errorf("A polygon needs at least 3 sides")
+		}
+		if cmd.Sides > maxSides {
+			return nil, fmt.Errorf("A polygon can have at most %d sides", maxSides)
+		}
+		p = Ngon(cmd.Sides, m.paper.PolygonSide)
+	} else {
+		args, err := cmd.Floats()
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		sides, angles, err := shapes[cmd.Op](args)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sides {
+			sides[i] *= m.paper.PolygonSide
+		}
+		p = TurtlePolygon(sides, angles)
+		if p == nil {
+			return nil, fmt.Errorf("%s is not a polygon", cmd)
+		}
+	}
+	if cmd.Flip {
+		p = mirror(p)
+	}
+	n := sides(p)
+	if cmd.Edge >= n {
+		return nil, fmt.Errorf("%s: a polygon with %d sides has no edge %d", cmd, n, cmd.Edge)
+	}
+	for i := 0; i < cmd.Edge; i++ {
+		p = p.Lnext()
+	}
+	return p, nil
+}
+
+// moveCursor runs edge(i), which puts the cursor on the perimeter edge
+// numbered i in Model.edges().
+func (m *Model) moveCursor(cmd script.Command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("edge takes an edge number")
+	}
+	i, err := strconv.Atoi(cmd.Args[0])
+	e := m.edges()[i]
+	if err != nil || e == nil {
+		return fmt.Errorf("No edge %s", cmd.Args[0])
+	}
+	if m.tabEdge[e.Q] {
+		return fmt.Errorf("The cursor can't go on a tab")
+	}
+	e = m.onPerimeter(e)
+	if e == nil {
+		return fmt.Errorf("Edge %d is not on the perimeter", i)
+	}
+	m.e0 = e
+	m.record(cmd.String())
+	return nil
+}
+
+// allTabs reports whether the perimeter that e is on is all tabs.
+func (m *Model) allTabs(e *Edge) bool {
+	for e1 := ccwPerimeter(e); *e1 != *e; e1 = ccwPerimeter(e1) {
+		if !m.tabEdge[e1.Q] {
+			return false
+		}
+	}
+	return m.tabEdge[e.Q]
+}
+
+// onPerimeter returns e or e.Sym(), whichever is on the perimeter of a
+// piece of the net with the piece on its left, or nil if e isn't on the
+// perimeter.
+func (m *Model) onPerimeter(e *Edge) *Edge {
+	for _, start := range m.outlines() {
+		for ePath := start; ; {
+			if ePath.Q == e.Q {
+				return ePath
+			}
+			ePath = ccwPerimeter(ePath)
+			if *ePath == *start {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// crease runs crease(n), which turns fold n, an edge between two
+// polygons or the base of a tab, the other way.
+func (m *Model) crease(cmd script.Command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("crease takes an edge number")
+	}
+	i, err := strconv.Atoi(cmd.Args[0])
+	e := m.edges()[i]
+	if err != nil || e == nil {
+		return fmt.Errorf("No edge %s", cmd.Args[0])
+	}
+	if !m.internal[e.Q] {
+		return fmt.Errorf("Edge %d is not a fold", i)
+	}
+	m.creased[e.Q] = !m.creased[e.Q]
+	m.record(cmd.String())
+	return nil
+}
+
+// valley reports whether the fold at the internal edge e is a valley
+// fold, seen from the printed side of the net.  A tab folds the same way
+// as the edge it is glued to, so as to go inside the solid.
+func (m *Model) valley(e *Edge) bool {
+	return m.valleys[e.Q] != m.inward != m.creased[e.Q]
+}
+
+// meshName turns the name of a mesh file into a name that can be an
+// argument of import: any directory part is dropped, and characters
+// other than letters, digits, '.', '-' and '_' become '_'.
+func meshName(name string) string {
+	name = filepath.Base(strings.TrimSpace(name))
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// importFile reads a mesh file and imports it with run, which is
+// m.command or m.interactive.  The mesh is added to m.meshes only if
+// the import succeeds, under a name of its own: the name of the file,
+// unless another mesh has that name, when it gets a number, as in
+// x-2.obj, so that import(name) always means the same mesh.
+func (m *Model) importFile(name string, data []byte, run func(string) error) error {
+	name = meshName(name)
+	msh, err := mesh.Read(name, data)
+	if err != nil {
+		return err
+	}
+	if err := msh.Orient(); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; m.meshes[name] != nil && !reflect.DeepEqual(m.meshes[name], msh); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if m.meshes[name] != nil {
+		return run("import(" + name + ")")
+	}
+	m.meshes[name] = msh
+	if err := run("import(" + name + ")"); err != nil {
+		delete(m.meshes, name)
+		return err
+	}
+	return nil
+}
+
+// importMesh runs import(name), which replaces the net with an unfolding
+// of the mesh of that name, and solid(name), which does the same for the
+// solid of that name in the catalog (see package polyhedra).  The faces
+// are laid out along a spanning tree of the mesh, each attached to its
+// parent like a polygon from the keyboard, so the net can be edited
+// afterwards like any other.
+func (m *Model) importMesh(cmd script.Command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("%s takes a name", cmd.Op)
+	}
+	msh := m.meshes[cmd.Args[0]]
+	if cmd.Op == "solid" {
+		var err error
+		if msh, err = polyhedra.Solid(cmd.Args[0]); err != nil {
+			return err
+		}
+	} else if msh == nil {
+		return fmt.Errorf("No mesh %s", cmd.Args[0])
+	}
+	tree, err := msh.Unfold()
+	if err != nil {
+		return fmt.Errorf("%s: %s", cmd.Args[0], err)
+	}
+	m.clear()
+	// the average edge is as long as the side of a polygon from the
+	// keyboard; attach scales each face to the edge it goes on, so only
+	// the first needs scaling
+	s := m.paper.PolygonSide / msh.EdgeLength()
+	edges := make([][]*Edge, len(msh.Faces)) // edges[f][k] is edge k of face f, with f on its left
+	for _, f := range tree.Order {
+		var pts []*Point2D
+		for _, p := range msh.Flatten(f) {
+			pts = append(pts, &Point2D{p.X * s, p.Y * s})
+		}
+		var e *Edge
+		if regular(pts) {
+			e = Ngon(len(pts), math.Hypot(pts[1].X-pts[0].X, pts[1].Y-pts[0].Y))
+		} else {
+			e = Polygon(pts)
+		}
+		edges[f] = make([]*Edge, len(pts))
+		for k := range pts {
+			edges[f][k] = e
+			e = e.Lnext()
+		}
+		if parent := tree.Parent[f]; parent.Face >= 0 {
+			m.e0 = edges[parent.Face][parent.K]
+			k := tree.Edge[f]
+			m.attachAndMove(edges[f][k])
+			edges[f][k] = edges[parent.Face][parent.K].Sym()
+		} else {
+			m.attachAndMove(edges[f][0])
+		}
+	}
+	if reflex, err := msh.Reflex(); err == nil {
+		for f := range reflex {
+			for k, r := range reflex[f] {
+				if r {
+					m.valleys[edges[f][k].Q] = true
+				}
+			}
+		}
+	}
+	m.glueMesh(msh, edges)
+	m.record(cmd.String())
+	return nil
+}
+
+// glueMesh records that the edges of a closed mesh that were cut to
+// unfold it are glued back together, as they were in the mesh, so that
+// the net needn't be folded to find out.  edges[f][k] is the edge of
+// the net for edge k of face f.
+func (m *Model) glueMesh(msh *mesh.Mesh, edges [][]*Edge) {
+	nbrs, err := msh.Neighbors()
+	if err != nil {
+		return
+	}
+	g := &gluing{key: netKey(m.net()), partner: make(map[string]string)}
+	for f := range nbrs {
+		for k, n := range nbrs[f] {
+			if n.Face < 0 {
+				return // the mesh has holes, so the net doesn't fold up
+			}
+			if a, b := edges[f][k], edges[n.Face][n.K]; a.Q != b.Q {
+				g.partner[edgeKey(a)] = edgeKey(b)
+			}
+		}
+	}
+	m.glue = g
+}
+
+// regular reports whether a polygon is regular: all of its sides are
+// the same length, and so are all of the diagonals that cut off a
+// corner.
+func regular(pts []*Point2D) bool {
+	n := len(pts)
+	side := math.Hypot(pts[1].X-pts[0].X, pts[1].Y-pts[0].Y)
+	diagonal := math.Hypot(pts[2].X-pts[0].X, pts[2].Y-pts[0].Y)
+	for i, p := range pts {
+		q, r := pts[(i+1)%n], pts[(i+2)%n]
+		if math.Abs(math.Hypot(q.X-p.X, q.Y-p.Y)-side) > 1e-6*side ||
+			math.Abs(math.Hypot(r.X-p.X, r.Y-p.Y)-diagonal) > 1e-6*side {
+			return false
+		}
+	}
+	return true
+}
+
+// sides returns the number of sides of the face to the left of e.
+func sides(e *Edge) int {
+	n := 1
+	for e1 := e.Lnext(); *e1 != *e; e1 = e1.Lnext() {
+		n++
+	}
+	return n
+}
+
+// perimeter returns the edges of the perimeter, other than tabs, in
+// order starting from the cursor.
+func (m *Model) perimeter() []*Edge {
+	if m.e0 == nil {
+		return nil
+	}
+	edges := []*Edge{m.e0}
+	for e := m.forwardSkipTabs(m.e0); *e != *m.e0; e = m.forwardSkipTabs(e) {
+		edges = append(edges, e)
+	}
+	return edges
+}
+
+// net returns the net to be folded: every polygon other than tabs, and
+// its boundary.  An edge with a tab on it is still on the boundary of
+// the net, since it is glued to the edge the tab is glued to.
+func (m *Model) net() *fold.Net {
+	net := new(fold.Net)
+	if m.e0 == nil {
+		return net
+	}
+	seen := make(map[Edge]bool)
+	face := func(e *Edge) []*Edge {
+		var loop []*Edge
+		for e1 := e; !seen[*e1]; e1 = e1.Lnext() {
+			seen[*e1] = true
+			loop = append(loop, e1)
+		}
+		return loop
+	}
+	outside := face(m.e0.Sym())
+	edges := m.edges()
+	for i := 0; i < len(edges); i++ {
+	polygon:
+		for _, e := range []*Edge{edges[i], edges[i].Sym()} {
+			loop := face(e)
+			for _, e1 := range loop {
+				if m.tabEdge[e1.Q] {
+					continue polygon
+				}
+			}
+			if loop != nil {
+				net.Faces = append(net.Faces, e)
+			}
+		}
+	}
+	// walk around the outside in CCW order, with the net on the left
+	for i := len(outside) - 1; i >= 0; i-- {
+		e := outside[i].Sym()
+		switch {
+		case !m.tabEdge[e.Q]:
+			net.Boundary = append(net.Boundary, e)
+		case !m.tabEdge[e.Lprev().Q]: // first edge of a tab
+			net.Boundary = append(net.Boundary, e.Lprev().Sym())
+		}
+	}
+	return net
+}
+
+// fold folds the net into a solid, and keeps the edges glued together
+// for the labels.
+func (m *Model) fold() (*fold.Net, *fold.Solid, error) {
+	if len(m.pieces) > 0 {
+		return nil, nil, fmt.Errorf("A net in %d pieces can't be folded", len(m.pieces)+1)
+	}
+	net := m.net()
+	if g := m.gluing(net); g != nil && g.partner != nil {
+		// the edges glued together are known, e.g., from an imported
+		// mesh, so fold it that way rather than search, and keep them
+		// for the labels even if the solid isn't convex
+		index := make(map[string]int)
+		for i, e := range net.Boundary {
+			index[edgeKey(e)] = i
+		}
+		var pairs [][2]int
+		for _, p := range m.gluedPairs(net, g) {
+			pairs = append(pairs, [2]int{index[edgeKey(p[0])], index[edgeKey(p[1])]})
+		}
+		solid, err := fold.Glue(net, pairs)
+		return net, solid, err
+	}
+	solid, err := fold.Fold(net)
+	m.glue = &gluing{key: netKey(net), err: err}
+	if err == nil {
+		m.glue.partner = make(map[string]string)
+		for _, p := range solid.Pairs {
+			a, b := edgeKey(net.Boundary[p[0]]), edgeKey(net.Boundary[p[1]])
+			m.glue.partner[a], m.glue.partner[b] = b, a
+		}
+	}
+	return net, solid, err
+}
+
+// points returns the corners of the face to the left of e.
+func points(e *Edge) []*Point2D {
+	pts := []*Point2D{e.Org()}
+	for e1 := e.Lnext(); *e1 != *e; e1 = e1.Lnext() {
+		pts = append(pts, e1.Org())
+	}
+	return pts
+}
+
+// overlaps returns the faces of the net, tabs included, that the
+// polygon of p would overlap, with p already placed on the cursor.
+func (m *Model) overlaps(p *Edge) [][]*Point2D {
+	var faces [][]*Point2D
+	pts := points(p)
+	for _, poly := range m.polygons() {
+		if geom.Overlap(pts, poly) {
+			faces = append(faces, poly)
+		}
+	}
+	return faces
+}
+
+// polygons returns the corners of every polygon of the model, including
+// tabs.
+func (m *Model) polygons() [][]*Point2D {
+	var polys [][]*Point2D
+	seen := make(map[Edge]bool)
+	for _, outline := range m.outlines() {
+		for e := outline.Sym(); !seen[*e]; e = e.Lnext() { // the outside
+			seen[*e] = true
+		}
+	}
+	for _, e := range m.edges() {
+		for _, e1 := range []*Edge{e, e.Sym()} {
+			if seen[*e1] {
+				continue
+			}
+			for e2 := e1; !seen[*e2]; e2 = e2.Lnext() {
+				seen[*e2] = true
+			}
+			polys = append(polys, points(e1))
+		}
+	}
+	return polys
+}
+
+// autoTabs runs T, which puts a tab on one edge of every pair of edges
+// that are glued together when the net is folded, unless one of them
+// already has a tab.  The tab goes on whichever edge of the pair it
+// fits at without overlapping anything, preferring the edge where it
+// needs shrinking least (see fitTab), and then the one where its
+// corners are less sharp.  The net is only folded if it hasn't been
+// already, or, for an imported mesh, glued as the mesh was.
+func (m *Model) autoTabs() error {
+	if m.e0 == nil {
+		return nil
+	}
+	net := m.net()
+	g := m.gluing(net)
+	if g == nil {
+		if _, _, err := m.fold(); err != nil {
+			return fmt.Errorf("Can't place tabs: %s", err)
+		}
+		g = m.glue
+	}
+	if g.err != nil {
+		return fmt.Errorf("Can't place tabs: %s", g.err)
+	}
+	polys := m.polygons()
+	cursor := m.e0
+	for _, p := range m.gluedPairs(net, g) {
+		a, b := p[0], p[1]
+		if m.internal[a.Q] || m.internal[b.Q] {
+			continue // already has a tab
+		}
+		var best *Edge
+		var bestPts []*Point2D
+		var bestStyle TabStyle
+		bestFits, bestAngle := false, 0.0
+		for _, e := range []*Edge{a, b} {
+			style, fits := m.fitTab(e, m.tabStyle, polys)
+			tab := Polygon(m.tabPoints(e, style))
+			if !place(e, tab) {
+				continue
+			}
+			pts := points(tab)
+			// the sharper of the corners at the ends of the edge
+			angle := math.Min(cornerAngle(pts[len(pts)-1], pts[0], pts[1]), cornerAngle(pts[0], pts[1], pts[2]))
+			switch {
+			case best == nil,
+				fits && !bestFits,
+				fits == bestFits && style.Height > bestStyle.Height,
+				fits == bestFits && style.Height == bestStyle.Height && angle > bestAngle+1e-9:
+				best, bestPts, bestStyle, bestFits, bestAngle = e, pts, style, fits, angle
+			}
+		}
+		if best == nil {
+			continue
+		}
+		m.e0 = best
+		m.addTab(bestStyle)
+		polys = append(polys, bestPts)
+	}
+	if !m.internal[cursor.Q] {
+		m.e0 = cursor
+	}
+	return nil
+}
+
+// gluedPairs returns the pairs of boundary edges of the net that g
+// glues together, in order of their numbers in Model.edges(), lower
+// first within each pair, so that the order depends only on the net.
+func (m *Model) gluedPairs(net *fold.Net, g *gluing) [][2]*Edge {
+	index := make(map[*QuadEdge]int)
+	for i, e := range m.edges() {
+		index[e.Q] = i
+	}
+	boundary := make(map[string]*Edge)
+	for _, e := range net.Boundary {
+		boundary[edgeKey(e)] = e
+	}
+	var pairs [][2]*Edge
+	for _, a := range net.Boundary {
+		b := boundary[g.partner[edgeKey(a)]]
+		if b != nil && index[a.Q] < index[b.Q] {
+			pairs = append(pairs, [2]*Edge{a, b})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return index[pairs[i][0].Q] < index[pairs[j][0].Q] })
+	return pairs
+}
+
+// cornerAngle returns the angle at b between the lines to a and c, in
+// degrees.
+func cornerAngle(a, b, c *Point2D) float64 {
+	d := math.Atan2(c.Y-b.Y, c.X-b.X) - math.Atan2(a.Y-b.Y, a.X-b.X)
+	return math.Abs(absAngle(d))
+}
+
+// A glueLabel labels an edge of the net with the number it shares with
+// the edge it is glued to.
+type glueLabel struct {
+	index int  // number of the edge in Model.edges()
+	sym   bool // whether the net is on the right of the numbered edge
+	tab   bool // whether there is a tab on the edge
+	label int
+}
+
+// A gluing records which edges of a net are glued together, by the
+// positions of their ends rather than by pointer or number, so that it
+// holds for the same net built again, e.g., after undo and redo, with
+// the cursor anywhere and whatever tabs it has.
+type gluing struct {
+	key     string            // description of the net, see netKey
+	partner map[string]string // the edge each boundary edge is glued to, or nil if the net doesn't fold
+	err     error             // why the net doesn't fold
+}
+
+// edgeKey describes an edge by the positions of its ends.
+func edgeKey(e *Edge) string {
+	return fmt.Sprintf("%g %g %g %g", e.Org().X, e.Org().Y, e.Dest().X, e.Dest().Y)
+}
+
+// netKey describes a net by the edges of its polygons.
+func netKey(net *fold.Net) string {
+	var keys []string
+	for _, e := range net.Faces {
+		for e1 := e; ; {
+			keys = append(keys, edgeKey(e1))
+			if e1 = e1.Lnext(); *e1 == *e {
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// gluing returns the edges glued together when the net is folded, if
+// it has been folded since it last changed, or else nil.
+func (m *Model) gluing(net *fold.Net) *gluing {
+	if m.glue == nil || m.glue.key != netKey(net) {
+		return nil
+	}
+	return m.glue
+}
+
+// foldForPrinting folds the net, unless it has been folded already,
+// when the edges glued together show on paper: in the labels, if
+// labels is set, or in the slits that slot tabs lock into.
+func (m *Model) foldForPrinting(labels bool) {
+	if m.e0 == nil || !labels && len(m.slots) == 0 || m.gluing(m.net()) != nil {
+		return
+	}
+	m.fold()
+}
+
+// glueLabels returns labels for the edges of the net that are glued
+// together when it is folded, or none if it doesn't fold into a solid
+// or hasn't been folded since it last changed.
+func (m *Model) glueLabels() []glueLabel {
+	net := m.net()
+	g := m.gluing(net)
+	if g == nil || g.partner == nil {
+		return nil
+	}
+	// Edges are labeled by number rather than by pointer, so that
+	// the labels are the same for the same net however it was built.
+	edges := m.edges()
+	index := make(map[*QuadEdge]int)
+	for i, e := range edges {
+		index[e.Q] = i
+	}
+	var labels []glueLabel
+	for i, p := range m.gluedPairs(net, g) {
+		for _, e := range p {
+			labels = append(labels, glueLabel{
+				index: index[e.Q],
+				sym:   *e != *edges[index[e.Q]],
+				tab:   m.internal[e.Q], // a boundary edge is internal only if it has a tab
+				label: i + 1,
+			})
+		}
+	}
+	return labels
+}
+
+// splitLabel is the label of a pair of edges on either side of a split
+// in the net: a letter, so as not to be mistaken for a gluing label.
+type splitLabel struct {
+	e     *Edge // with the net on its left
+	tab   bool
+	label string
+}
+
+// splitLabels labels the edges along which the net was split into
+// pieces with letters, A to Z, then AA and so on.  A split edge that
+// has since had a polygon other than a tab attached to it isn't glued
+// any more, so neither it nor its partner is labeled.
+func (m *Model) splitLabels() []splitLabel {
+	var labels []splitLabel
+	for _, p := range m.splits {
+		pair := []splitLabel{}
+		for _, e := range p {
+			tab := m.internal[e.Q]
+			if tab && !m.tabEdge[e.Sym().Lnext().Q] {
+				break
+			}
+			pair = append(pair, splitLabel{e: e, tab: tab})
+		}
+		if len(pair) < 2 {
+			continue
+		}
+		label := ""
+		for i := len(labels)/2 + 1; i > 0; i = (i - 1) / 26 {
+			label = string(rune('A'+(i-1)%26)) + label
+		}
+		for _, l := range pair {
+			l.label = label
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
+
+// slits returns the ends of the slits that slot tabs lock into.  A slit
+// is in the edge that the tab is glued to, so the net must fold up for
+// there to be any.  It is as long as the neck of the tab, half the edge.
+func (m *Model) slits() [][2]*Point2D {
+	if len(m.slots) == 0 {
+		return nil
+	}
+	var slits [][2]*Point2D
+	labels := m.glueLabels()
+	numbered := m.edges()
+	edge := func(l glueLabel) *Edge {
+		e := numbered[l.index]
+		if l.sym {
+			e = e.Sym()
+		}
+		return e
+	}
+	for i := 0; i+1 < len(labels); i += 2 { // labels come in pairs
+		a, b := edge(labels[i]), edge(labels[i+1])
+		depth, ok := m.slots[a.Q]
+		if !ok {
+			depth, ok = m.slots[b.Q]
+			a, b = b, a
+		}
+		if !ok || !labels[i].tab && !labels[i+1].tab {
+			continue
+		}
+		// b has the net on its left
+		dx, dy := b.Dest().X-b.Org().X, b.Dest().Y-b.Org().Y
+		point := func(t float64) *Point2D {
+			return &Point2D{b.Org().X + dx*t - dy*depth, b.Org().Y + dy*t + dx*depth}
+		}
+		slits = append(slits, [2]*Point2D{point(0.24), point(0.76)})
+	}
+	return slits
+}
+
+// drawLabel writes a label next to e, inside the net, or on the tab if
+// e has one.
+func drawLabel(s *svg.SVG, e *Edge, tab bool, label string) {
+	length := edgeLength(e)
+	offset := length / 6
+	if tab {
+		offset = -length / 8
+	}
+	dx, dy := (e.Dest().X-e.Org().X)/length, (e.Dest().Y-e.Org().Y)/length
+	x := (e.Org().X+e.Dest().X)/2 - dy*offset
+	y := (e.Org().Y+e.Dest().Y)/2 + dx*offset
+	s.Text(x, y, label,
+		fmt.Sprintf("font-size:%f;font-family:sans-serif;text-anchor:middle;dominant-baseline:central;fill:#000", length/6))
+}
+
+// foldReport describes the solid that the net folds into: which edges
+// are glued together, and the angles between the faces at every edge.
+func (m *Model) foldReport(w io.Writer) error {
+	net, solid, err := m.fold()
+	if err != nil {
+		return err
+	}
+	index := make(map[*QuadEdge]int)
+	for i, e := range m.edges() {
+		index[e.Q] = i
+	}
+	fmt.Fprintf(w, "The net folds into a solid with %d vertices, %d edges and %d faces.\n",
+		len(solid.Vertices), len(solid.Hinges), len(solid.Faces))
+	fmt.Fprintf(w, "\nEdges glued together:\n")
+	for _, p := range solid.Pairs {
+		fmt.Fprintf(w, "\t%d and %d\n", index[net.Boundary[p[0]].Q], index[net.Boundary[p[1]].Q])
+	}
+	fmt.Fprintf(w, "\nAngles between faces:\n")
+	for _, h := range solid.Hinges {
+		if h.Glued != nil {
+			fmt.Fprintf(w, "\tedges %d and %d: %.1f°\n", index[h.Edge.Q], index[h.Glued.Q], h.Dihedral)
+		} else {
+			fmt.Fprintf(w, "\tedge %d: %.1f°\n", index[h.Edge.Q], h.Dihedral)
 		}
-		out := draw(&options{false, false})
-		file.Write(out)
-		return nil // don't add "s" to command history
-	case "t":
-		if e0 == nil {
-			return nil
+	}
+	fmt.Fprintf(w, "\nVertices:\n")
+	for _, v := range solid.Vertices {
+		fmt.Fprintf(w, "\t%.2f %.2f %.2f\n", v.X, v.Y, v.Z)
+	}
+	return nil
+}
+
+// httpError writes the error as the response, escaped, since the page
+// shows it as HTML, and some errors quote what the user gave, e.g., the
+// names in a project file.
+func httpError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	w.Write([]byte(html.EscapeString(err.Error())))
+}
+
+// Fold reports on the solid that the net folds into, as text.
+func Fold(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf := new(bytes.Buffer)
+	if err := m.foldReport(buf); err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// The states of a vertex on the perimeter of the net, going by the sum
+// of the corners of the polygons at the vertex.
+const (
+	vertexOpen   = iota // there is room for more polygons
+	vertexClosed        // no polygon of the net fits any more, so it is ready to glue
+	vertexFlat          // the corners add up to 360° or more, so it can never fold up
+)
+
+var vertexStates = []string{"open", "closed", "can't fold"}
+var vertexColors = []string{"#fa0", "#0a0", "#f00"}
+
+type vertexAngles struct {
+	e     *Edge   // perimeter edge from the vertex, with the net on its left
+	faces int     // number of polygons at the vertex, not counting tabs
+	sum   float64 // sum of their corners at the vertex, in degrees
+	state int
+}
+
+// vertexAngles adds up the corners of the polygons, not counting tabs,
+// at each vertex on the perimeter of the net, going around the vertex
+// by the ring of edges from it.  A vertex is closed when the net is
+// known to fold up, from folding it since it last changed, or when the
+// gap left is no bigger than the smallest corner of any polygon of the
+// net.  The vertices are worked out for every drawing, so they never
+// fold the net themselves.
+func (m *Model) vertexAngles() []vertexAngles {
+	if m.e0 == nil {
+		return nil
+	}
+	outlines := m.outlines()
+	outside := make(map[Edge]bool) // edges with the outside on their left
+	for _, start := range outlines {
+		for e := start.Sym(); !outside[*e]; e = e.Lnext() {
+			outside[*e] = true
 		}
-		if !tabEdge[e0.Q] { // e0 can be a tab edge if entire perimeter is tabs; don't attach a tab to a tab
-			attachAndMove(tab(e0))
+	}
+	polygon := func(e *Edge) bool { // whether the face to the left of e is a polygon
+		if outside[*e] {
+			return false
 		}
-	case "u":
-		commands := history.String()
-		if len(commands) == 0 {
-			return nil // nothing to undo
+		for e1 := e.Lnext(); ; e1 = e1.Lnext() {
+			if m.tabEdge[e1.Q] {
+				return false
+			}
+			if *e1 == *e {
+				return true
+			}
 		}
-		// undo last command by replaying all commands...
-		commands = commands[:len(commands)-1] // ... except last command ...
-		command("z")                          // ... starting from zero state.
-		for _, cmd := range commands {
-			command(string(cmd))
+	}
+	corner := func(e *Edge) float64 { // corner of the face to the left of e, at its origin
+		a := edgeRadians(e.Onext()) - edgeRadians(e)
+		for a <= 0 {
+			a += 2 * math.Pi
 		}
-		return nil // don't add "u" to command history
-	case "v":
-		if e0 == nil {
-			return nil
+		return a / math.Pi * 180
+	}
+	smallest := 360.0
+	for _, e := range m.edges() {
+		for _, e1 := range []*Edge{e, e.Sym()} {
+			if polygon(e1) {
+				smallest = math.Min(smallest, corner(e1))
+			}
 		}
-		if !tabEdge[e0.Q] { // e0 can be a tab edge if entire perimeter is tabs; don't attach a tab to a tab
-			attachAndMove(traySide())
+	}
+	g := m.gluing(m.net())
+	folds := g != nil && g.partner != nil
+	const epsilon = 1e-6
+	var vertices []vertexAngles
+	seen := make(map[Edge]bool)
+	for _, start := range outlines {
+		for e := start; ; {
+			if !seen[*e] {
+				v := vertexAngles{e: e}
+				for e1 := e; !seen[*e1]; e1 = e1.Onext() {
+					seen[*e1] = true
+					if polygon(e1) {
+						v.faces++
+						v.sum += corner(e1)
+					}
+				}
+				switch gap := 360 - v.sum; {
+				case gap <= epsilon:
+					v.state = vertexFlat
+				case folds || gap <= smallest+epsilon:
+					v.state = vertexClosed
+				}
+				if v.faces > 0 { // not just the corner of a tab
+					vertices = append(vertices, v)
+				}
+			}
+			e = ccwPerimeter(e)
+			if *e == *start {
+				break
+			}
 		}
-	case "z":
-		e0 = nil
-		internal = make(map[*QuadEdge]bool)
-		tabEdge = make(map[*QuadEdge]bool)
-		reversed = false
-		maximize = false
-		history = new(bytes.Buffer)
-		return nil // don't add "z" to (now empty) command history
-	default:
-		return fmt.Errorf("Unknown command") // don't add errors to command history
 	}
-	fmt.Fprintf(history, "%s", cmd) // NB cmd is a single character
-	return nil
+	return vertices
+}
+
+// vertexReport lists the vertices on the perimeter of the net, with the
+// sum of the corners of the polygons at each one.  A vertex is given by
+// the number of the perimeter edge from it.
+func (m *Model) vertexReport(w io.Writer) {
+	vertices := m.vertexAngles()
+	index := make(map[*QuadEdge]int)
+	for i, e := range m.edges() {
+		index[e.Q] = i
+	}
+	count := make([]int, len(vertexStates))
+	for _, v := range vertices {
+		count[v.state]++
+	}
+	fmt.Fprintf(w, "%d vertices on the perimeter: %d open, %d closed and ready to glue, %d at 360° or more, which can't fold up.\n",
+		len(vertices), count[vertexOpen], count[vertexClosed], count[vertexFlat])
+	fmt.Fprintf(w, "\nVertices:\n")
+	for _, v := range vertices {
+		fmt.Fprintf(w, "\tedge %d (%.1f, %.1f): %d faces, %.1f°, %s\n",
+			index[v.e.Q], v.e.Org().X, v.e.Org().Y, v.faces, v.sum, vertexStates[v.state])
+	}
+}
+
+// Vertices reports on the vertices on the perimeter of the net, as text.
+func Vertices(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	m.vertexReport(w)
+}
+
+// Load replaces the net with a net of the solid given by the solid
+// parameter, with tabs.  Without a session, as when the URL is typed
+// into the browser, it starts a new session that loads the solid.
+func Load(w http.ResponseWriter, req *http.Request) {
+	solid := req.FormValue("solid")
+	if req.FormValue("s") == "" {
+		http.Redirect(w, req, "/?s="+newSessionId()+"&solid="+url.QueryEscape(solid), http.StatusFound)
+		return
+	}
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if strings.ContainsAny(solid, "(),#") {
+		err = fmt.Errorf("No solid %s", solid)
+	} else if err = m.interactive("solid(" + solid + ")"); err == nil {
+		m.interactive("T") // a net without tabs is better than none
+	}
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	out := m.draw(nil)
+	w.Write(out) // ignore err
+}
+
+// Limit on the size of an uploaded mesh file.
+var maxMeshBytes int64 = 20 << 20
+
+// Import reads the mesh file in the request body, named by the name
+// parameter, and replaces the net with an unfolding of it.
+func Import(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxMeshBytes+1))
+	if err == nil && int64(len(data)) > maxMeshBytes {
+		err = fmt.Errorf("Mesh files can be at most %d bytes", maxMeshBytes)
+	}
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.importFile(req.FormValue("name"), data, m.interactive); err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	out := m.draw(nil)
+	w.Write(out) // ignore err
 }
 
 func Compile(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
 	cmd, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		w.WriteHeader(404)
-		w.Write([]byte(err.Error()))
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err = m.interactive(string(cmd))
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	out := m.draw(nil)
+	w.Write(out) // ignore err
+}
+
+// Cursor moves the cursor to the perimeter edge given by the edge
+// parameter, and, if the sides parameter is given, attaches a polygon
+// with that many sides there.
+func Cursor(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	edge, err := strconv.Atoi(req.FormValue("edge"))
+	prog := fmt.Sprintf("edge(%d)", edge)
+	if sides := req.FormValue("sides"); err == nil && sides != "" {
+		if _, err = strconv.Atoi(sides); err == nil {
+			prog += " " + sides // one program, so that it all happens or none of it
+		}
+	}
+	if err == nil {
+		err = m.interactive(prog)
+	}
+	if err != nil {
+		httpError(w, 404, err)
 		return
 	}
-	err = command(string(cmd))
+	out := m.draw(nil)
+	w.Write(out) // ignore err
+}
+
+// History: GET returns the undo tree as HTML, POST moves the model to
+// the node given by the node parameter.
+func History(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
 	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req.Method != "POST" {
+		buf := new(bytes.Buffer)
+		m.undoTree(buf)
+		w.Write(buf.Bytes())
+		return
+	}
+	id, err := strconv.Atoi(req.FormValue("node"))
+	n := m.undoNodes[id]
+	if err != nil || n == nil {
 		w.WriteHeader(404)
-		w.Write([]byte(err.Error()))
+		w.Write([]byte("No such history"))
+		return
+	}
+	if err := m.restore(n); err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	out := m.draw(nil)
+	w.Write(out) // ignore err
+}
+
+// Project files (.manifold) record everything needed to resume editing a
+// model.  The history alone rebuilds the net; the cursor and the edge
+// classification are saved as well so that they are restored exactly.
+// Edges are identified by their number in Model.edges().
+type project struct {
+	Version    int               `json:"version"`
+	History    string            `json:"history"`
+	Cursor     *projectEdge      `json:"cursor,omitempty"`
+	Reversed   bool              `json:"reversed"`
+	Maximize   bool              `json:"maximize"`
+	HideLabels bool              `json:"hideLabels,omitempty"`
+	Paper      Paper             `json:"paper"`
+	Colors     *Colors           `json:"colors,omitempty"`
+	Edges      []projectEdge     `json:"edges"`
+	Meshes     map[string]string `json:"meshes,omitempty"` // imported meshes, as OBJ files
+}
+
+type projectEdge struct {
+	Index    int  `json:"index"`
+	Sym      bool `json:"sym,omitempty"` // cursor only: edge is Sym() of numbered edge
+	Internal bool `json:"internal,omitempty"`
+	Tab      bool `json:"tab,omitempty"`
+}
+
+// Version 1 projects have a history of single-character commands
+// without spaces; since version 2 the history is a program.
+var projectVersion = 2
+
+func (m *Model) saveProject() ([]byte, error) {
+	p := &project{
+		Version:    projectVersion,
+		History:    m.history(),
+		Reversed:   m.reversed,
+		Maximize:   m.maximize,
+		Paper:      m.paper,
+		Colors:     &m.colors,
+		HideLabels: m.hideLabels,
+	}
+	for _, c := range m.current.path() {
+		cmd, err := script.Parse(c)
+		if err != nil || len(cmd) != 1 || cmd[0].Op != "import" || len(cmd[0].Args) != 1 {
+			continue
+		}
+		if msh := m.meshes[cmd[0].Args[0]]; msh != nil {
+			buf := new(bytes.Buffer)
+			if err := msh.WriteOBJ(buf); err != nil {
+				return nil, err
+			}
+			if p.Meshes == nil {
+				p.Meshes = make(map[string]string)
+			}
+			p.Meshes[cmd[0].Args[0]] = buf.String()
+		}
+	}
+	edges := m.edges()
+	p.Edges = make([]projectEdge, len(edges))
+	for i := 0; i < len(edges); i++ {
+		e := edges[i]
+		p.Edges[i] = projectEdge{Index: i, Internal: m.internal[e.Q], Tab: m.tabEdge[e.Q]}
+		if m.e0 != nil && e.Q == m.e0.Q {
+			p.Cursor = &projectEdge{Index: i, Sym: *e != *m.e0}
+		}
+	}
+	return json.MarshalIndent(p, "", "\t")
+}
+
+// loadProject replaces the model with the project in data.  A project
+// that doesn't load leaves the model, and its undo tree, as they were.
+func (m *Model) loadProject(data []byte) (err error) {
+	p := new(project)
+	if err := json.Unmarshal(data, p); err != nil {
+		return fmt.Errorf("Not a manifold project: %s", err)
+	}
+	history := p.History
+	switch p.Version {
+	case 1:
+		history = strings.Join(strings.Split(history, ""), " ")
+	case projectVersion:
+	default:
+		return fmt.Errorf("Unsupported project version %d", p.Version)
+	}
+	if err := p.Paper.check(); err != nil {
+		return fmt.Errorf("Bad project paper: %s", err)
+	}
+	if p.Colors != nil {
+		if err := p.Colors.check(); err != nil {
+			return err
+		}
+	}
+	rollback := m.checkpoint()
+	defer func() {
+		if err != nil {
+			rollback()
+		}
+	}()
+	m.command("z")
+	m.paper = p.Paper
+	if p.Colors != nil {
+		m.colors = *p.Colors
+	}
+	m.meshes = make(map[string]*mesh.Mesh)
+	for name, obj := range p.Meshes {
+		msh, err := mesh.ReadOBJ(strings.NewReader(obj))
+		if err != nil {
+			return fmt.Errorf("Bad project mesh %s: %s", name, err)
+		}
+		m.meshes[name] = msh
+	}
+	if err := m.command(history); err != nil {
+		return fmt.Errorf("Bad project history: %s", err)
+	}
+	m.reversed = p.Reversed
+	m.maximize = p.Maximize
+	m.hideLabels = p.HideLabels
+	edges := m.edges()
+	if len(p.Edges) != len(edges) {
+		return fmt.Errorf("Project edges do not match its history")
+	}
+	// The history builds the whole net again, so the edges only need
+	// checking: a net that comes out differently isn't the one saved.
+	for _, pe := range p.Edges {
+		e := edges[pe.Index]
+		if e == nil || m.internal[e.Q] != pe.Internal || m.tabEdge[e.Q] != pe.Tab {
+			return fmt.Errorf("Project edges do not match its history")
+		}
+	}
+	if p.Cursor != nil {
+		// attaching at the cursor splices onto it, so it must be on the
+		// perimeter, the right way round, and not on a tab unless the
+		// whole perimeter is tabs, as after t*
+		e := edges[p.Cursor.Index]
+		if e != nil && p.Cursor.Sym {
+			e = e.Sym()
+		}
+		if e == nil || m.onPerimeter(e) == nil || *m.onPerimeter(e) != *e || m.tabEdge[e.Q] && !m.allTabs(e) {
+			return fmt.Errorf("Project cursor is not on the perimeter of the net")
+		}
+		m.e0 = e
+	}
+	return nil
+}
+
+// Project: GET downloads the session's model as a project file, POST
+// replaces the model with the project in the request body.
+func Project(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req.Method != "POST" {
+		out, err := m.saveProject()
+		if err != nil {
+			httpError(w, 500, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"model.manifold\"")
+		w.Write(out)
+		return
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	if err := m.loadProject(data); err != nil {
+		httpError(w, 404, err)
 		return
 	}
-	out := draw(nil)
+	out := m.draw(nil)
 	w.Write(out) // ignore err
 }
 
+var outputDir = "."
+var defaultSaveName = "hello.svg"
+
+// saveName turns a user-supplied name into the name of an SVG file in
+// outputDir.  Any directory part of the name is ignored.
+func saveName(name string) (string, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("Bad file name")
+	}
+	if strings.ToLower(filepath.Ext(name)) != ".svg" {
+		name += ".svg"
+	}
+	return name, nil
+}
+
+// save writes the model, ready to print, to the file name in outputDir,
+// and returns the path of the file written.
+func (m *Model) save(name, layer string) (string, error) {
+	name, err := saveName(name)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(outputDir, layerName(name, layer))
+	m.foldForPrinting(!m.hideLabels)
+	out := m.draw(&options{false, false, !m.hideLabels, layer})
+	if err := ioutil.WriteFile(path, out, 0666); err != nil {
+		return "", fmt.Errorf("Can't save: %s", err)
+	}
+	return path, nil
+}
+
+// Save writes the model to a file on the server, or, given download=1,
+// sends it to the browser as an attachment.  Given layer=cut or
+// layer=score, only that layer is written, to a file named for it, and
+// given layer=cut,score, both are written, to two files.
+func Save(w http.ResponseWriter, req *http.Request) {
+	m, err := sessionModel(req)
+	if err != nil {
+		httpError(w, 404, err)
+		return
+	}
+	name := req.FormValue("name")
+	if name == "" {
+		name = defaultSaveName
+	}
+	layers := strings.Split(req.FormValue("layer"), ",")
+	for _, layer := range layers {
+		if layer != "" && layer != "cut" && layer != "score" {
+			w.WriteHeader(404)
+			w.Write([]byte(html.EscapeString("No layer " + layer)))
+			return
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req.FormValue("download") == "1" {
+		name, err := saveName(name)
+		if err == nil && len(layers) > 1 {
+			err = fmt.Errorf("Download one layer at a time")
+		}
+		if err != nil {
+			httpError(w, 404, err)
+			return
+		}
+		m.foldForPrinting(!m.hideLabels)
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": layerName(name, layers[0])}))
+		w.Write(m.draw(&options{false, false, !m.hideLabels, layers[0]}))
+		return
+	}
+	var paths []string
+	for _, layer := range layers {
+		path, err := m.save(name, layer)
+		if err != nil {
+			httpError(w, 404, err)
+			return
+		}
+		paths = append(paths, path)
+	}
+	w.Write([]byte(html.EscapeString("Saved " + strings.Join(paths, " and "))))
+}
+
 type options struct {
 	border bool
 	cursor bool
+	labels bool
+	layer  string // "cut" or "score" for only that layer, "" for the whole net
+}
+
+// Colors are the colours of the lines of a net, so that cutting
+// machines can tell them apart: lines to cut, and mountain and valley
+// folds to score.
+type Colors struct {
+	Cut      string `json:"cut"`
+	Mountain string `json:"mountain"`
+	Valley   string `json:"valley"`
+}
+
+var defaultColors = Colors{Cut: "#000000", Mountain: "#0000ff", Valley: "#ff00ff"}
+
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+// colorFlags adds flags for the colours of the lines to flags.
+func colorFlags(flags *flag.FlagSet, c *Colors) {
+	flags.StringVar(&c.Cut, "cut-color", c.Cut, "colour of lines to cut")
+	flags.StringVar(&c.Mountain, "mountain-color", c.Mountain, "colour of mountain folds")
+	flags.StringVar(&c.Valley, "valley-color", c.Valley, "colour of valley folds")
 }
 
-var documentUnits = "in"
-var documentUnitWidth = 11.0
-var documentUnitHeight = 8.5
-var documentWidth = 1100.0
-var documentHeight = 850.0
-var documentMargin = 25.0
-var documentPolygonSide = 100.0
+// check returns an error unless every colour is an SVG colour, #rgb,
+// #rrggbb or a name.
+func (c Colors) check() error {
+	for _, color := range []string{c.Cut, c.Mountain, c.Valley} {
+		if !colorPattern.MatchString(color) {
+			return fmt.Errorf("Bad colour %q; try #rgb, #rrggbb or a name such as red", color)
+		}
+	}
+	return nil
+}
+
+// layerName returns the name of the file for one layer of the net saved
+// as name: cube-cut.svg for the cut layer of cube.svg.
+func layerName(name, layer string) string {
+	if layer == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "-" + layer + ".svg"
+}
+
+// Paper settings.  Width, Height, Margin and PolygonSide are in SVG
+// user units; the page itself is UnitWidth by UnitHeight Units.
+type Paper struct {
+	Units       string  `json:"units"`
+	UnitWidth   float64 `json:"unitWidth"`
+	UnitHeight  float64 `json:"unitHeight"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Margin      float64 `json:"margin"`
+	PolygonSide float64 `json:"polygonSide"`
+}
+
+var letterPaper = Paper{"in", 11.0, 8.5, 1100.0, 850.0, 25.0, 100.0}
+
+// Paper sizes by name, all landscape.  Metric sizes use 4 user units per
+// millimeter, close to the 100 per inch of the US sizes.
+var papers = map[string]Paper{
+	"letter":  letterPaper,
+	"legal":   {"in", 14.0, 8.5, 1400.0, 850.0, 25.0, 100.0},
+	"tabloid": {"in", 17.0, 11.0, 1700.0, 1100.0, 25.0, 100.0},
+	"a4":      {"mm", 297.0, 210.0, 1188.0, 840.0, 25.0, 100.0},
+	"a3":      {"mm", 420.0, 297.0, 1680.0, 1188.0, 25.0, 100.0},
+}
+
+var defaultPaper = letterPaper
+
+func paperNames() string {
+	var names []string
+	for name := range papers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func lookupPaper(name string) (Paper, error) {
+	paper, ok := papers[strings.ToLower(name)]
+	if !ok {
+		return paper, fmt.Errorf("Unknown paper %q (choose from %s)", name, paperNames())
+	}
+	return paper, nil
+}
+
+// check returns an error unless the paper has room for a net, with
+// units that SVG knows.
+func (p Paper) check() error {
+	if _, ok := unitsPerInch[p.Units]; !ok {
+		return fmt.Errorf("Unknown units %q", p.Units)
+	}
+	if p.UnitWidth <= 0 || p.UnitHeight <= 0 || p.Width <= 0 || p.Height <= 0 || p.PolygonSide <= 0 {
+		return fmt.Errorf("Sizes must be positive")
+	}
+	if p.Margin < 0 || 2*p.Margin >= p.Width || 2*p.Margin >= p.Height {
+		return fmt.Errorf("Margin %g doesn't fit on the page", p.Margin)
+	}
+	return nil
+}
 
 // convex hull, assuming e0 is an edge on the perimeter of the polygon in ccw orientation
 // TODO: use this to find the best fit on the paper
-func convexHull() *Edge {
+func (m *Model) convexHull() *Edge {
+	e0 := m.e0
 	if e0 == nil {
 		return nil
 	}
@@ -615,18 +3370,39 @@ func convexHull() *Edge {
 	return hull
 }
 
-func draw(opt *options) []byte {
-	printBorder, printCursor := true, true
+// foldStyle returns the style of the fold at e: mountain folds are
+// dotted, and valley folds dashed, each in its own colour.
+func (m *Model) foldStyle(e *Edge) string {
+	if m.valley(e) {
+		return "stroke:" + m.colors.Valley + ";stroke-width:1;stroke-dasharray:6 3"
+	}
+	return "stroke:" + m.colors.Mountain + ";stroke-width:1;stroke-dasharray:1 4"
+}
+
+// startLayer starts a group for the lines of one layer, cut or score,
+// which Inkscape and programs for cutting machines take as a layer.
+func startLayer(s *svg.SVG, name string) {
+	s.Group(fmt.Sprintf("id=%q", name), `inkscape:groupmode="layer"`, fmt.Sprintf("inkscape:label=%q", name))
+}
+
+func (m *Model) draw(opt *options) []byte {
+	printBorder, printCursor, printLabels := true, true, !m.hideLabels
+	layer := ""
 	if opt != nil {
 		printBorder = opt.border
 		printCursor = opt.cursor
+		printLabels = opt.labels
+		layer = opt.layer
 	}
 	buf := new(bytes.Buffer)
 	s := svg.New(buf)
-	s.Startunit(documentUnitWidth, documentUnitHeight, documentUnits, fmt.Sprintf("viewBox='0 0 %f %f'", documentWidth, documentHeight))
+	paper := m.paper
+	s.Startunit(paper.UnitWidth, paper.UnitHeight, paper.Units, fmt.Sprintf("viewBox='0 0 %f %f'", paper.Width, paper.Height),
+		`xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"`)
 	if printBorder {
-		s.Rect(0, 0, documentWidth, documentHeight, "stroke:black; fill:none")
+		s.Rect(0, 0, paper.Width, paper.Height, "stroke:black; fill:none")
 	}
+	e0 := m.e0
 	if e0 == nil {
 		s.End()
 		return buf.Bytes()
@@ -635,41 +3411,99 @@ func draw(opt *options) []byte {
 	s.Marker("Triangle", 9, 3, 10, 6, "viewBox='0 0 10 6' markerUnits='strokeWidth' orient='auto' fill='red'")
 	s.Path("M 0 0 L 10 3 L 0 6 z")
 	s.MarkerEnd()
-	small, big := BoundingBox(e0)
+	small, big := m.boundingBox()
+
+	// the pending polygon, placed where it would be attached
+	var pending *Edge
+	if m.pending != nil && printCursor {
+		p, err := m.polygon(*m.pending)
+		if err == nil && place(e0, p) {
+			pending = p
+			psmall, pbig := BoundingBox(p)
+			small = &Point2D{math.Min(small.X, psmall.X), math.Min(small.Y, psmall.Y)}
+			big = &Point2D{math.Max(big.X, pbig.X), math.Max(big.Y, pbig.Y)}
+		}
+	}
 
 	// margin
-	s.Gtransform(fmt.Sprintf("translate(%f,%f)", documentMargin, documentMargin))
+	s.Gtransform(fmt.Sprintf("translate(%f,%f)", paper.Margin, paper.Margin))
 
 	scale := 1.0
 	width := big.X - small.X
 	height := big.Y - small.Y
-	scaleX := (documentWidth - 2*documentMargin) / width
-	scaleY := (documentHeight - 2*documentMargin) / height
-	if scaleX < 1 || scaleY < 1 || maximize { // must scale down to fit or up to maximize
+	scaleX := (paper.Width - 2*paper.Margin) / width
+	scaleY := (paper.Height - 2*paper.Margin) / height
+	if scaleX < 1 || scaleY < 1 || m.maximize { // must scale down to fit or up to maximize
 		scale = math.Min(scaleX, scaleY)
 	}
 	if scale != 1 {
 		s.Gtransform(fmt.Sprintf("scale(%f)", scale))
 	}
 
-	shift := small.X < 0 || small.Y < 0 || maximize
+	shift := small.X < 0 || small.Y < 0 || m.maximize
 	if shift {
 		dx, dy := -small.X, -small.Y
 		s.Gtransform(fmt.Sprintf("translate(%f,%f)", dx, dy))
 	}
 
-	// Draw the perimeter as one continuous path, for efficient cutting
+	// Draw the perimeter of each piece as one continuous path, for
+	// efficient cutting, and the slits for tabs that lock into the
+	// edges they are glued to
+	outlines := m.outlines()
 	pathbuf := new(bytes.Buffer)
-	fmt.Fprintf(pathbuf, "M %f %f %f %f", e0.Org().X, e0.Org().Y, e0.Dest().X, e0.Dest().Y)
-	for ePath := ccwPerimeter(e0); *ePath != *e0; ePath = ccwPerimeter(ePath) {
-		fmt.Fprintf(pathbuf, "L %f %f", ePath.Dest().X, ePath.Dest().Y)
+	if layer != "score" {
+		startLayer(s, "cut")
+		for _, start := range outlines {
+			pathbuf.Reset()
+			fmt.Fprintf(pathbuf, "M %f %f %f %f", start.Org().X, start.Org().Y, start.Dest().X, start.Dest().Y)
+			for ePath := ccwPerimeter(start); *ePath != *start; ePath = ccwPerimeter(ePath) {
+				fmt.Fprintf(pathbuf, "L %f %f", ePath.Dest().X, ePath.Dest().Y)
+			}
+			s.Path(string(pathbuf.Bytes()), "stroke:"+m.colors.Cut+";stroke-width:1;fill:none")
+		}
+		for _, slit := range m.slits() {
+			s.Line(slit[0].X, slit[0].Y, slit[1].X, slit[1].Y, "stroke:"+m.colors.Cut+";stroke-width:1")
+		}
+		s.Gend()
+	}
+
+	if printCursor {
+		// Invisible but clickable folds, for turning them the other
+		// way, and perimeter edges, for moving the cursor with the
+		// mouse, with ids giving their numbers
+		index := make(map[*QuadEdge]int)
+		numbered := m.edges()
+		for i := 0; i < len(numbered); i++ {
+			e := numbered[i]
+			index[e.Q] = i
+			if m.internal[e.Q] {
+				s.Line(e.Org().X, e.Org().Y,
+					e.Dest().X, e.Dest().Y,
+					fmt.Sprintf("id='fold-%d'", i),
+					"stroke:#fff;stroke-opacity:0;stroke-width:8;cursor:pointer")
+			}
+		}
+		for _, start := range outlines {
+			ePath := start
+			for {
+				if !m.tabEdge[ePath.Q] {
+					s.Line(ePath.Org().X, ePath.Org().Y,
+						ePath.Dest().X, ePath.Dest().Y,
+						fmt.Sprintf("id='edge-%d'", index[ePath.Q]),
+						"stroke:#fff;stroke-opacity:0;stroke-width:12;cursor:pointer")
+				}
+				ePath = ccwPerimeter(ePath)
+				if *ePath == *start {
+					break
+				}
+			}
+		}
 	}
-	s.Path(string(pathbuf.Bytes()), "stroke:#000;stroke-width:1;fill:none")
 
 	if debug {
 		// Draw the convex hull
 		pathbuf.Reset()
-		hull := convexHull()
+		hull := m.convexHull()
 		fmt.Fprintf(pathbuf, "M %f %f %f %f", hull.Org().X, hull.Org().Y, hull.Dest().X, hull.Dest().Y)
 		for ePath := ccwPerimeter(hull); *ePath != *hull; ePath = ccwPerimeter(ePath) {
 			fmt.Fprintf(pathbuf, "L %f %f", ePath.Dest().X, ePath.Dest().Y)
@@ -677,20 +3511,84 @@ func draw(opt *options) []byte {
 		s.Path(string(pathbuf.Bytes()), "stroke:#000;stroke-width:3;fill:none")
 	}
 
-	// Draw interior edges and the cursor
-	for i, e := range e0.Edges() {
-		if i == 0 && printCursor {
-			if reversed {
-				e = e.Sym()
-			}
-			s.Line(e.Org().X, e.Org().Y,
-				e.Dest().X, e.Dest().Y,
-				"marker-end='url(#Triangle)' style='stroke:#f00;stroke-width:2'")
-		} else if internal[e.Q] {
-			s.Line(e.Org().X, e.Org().Y,
-				e.Dest().X, e.Dest().Y,
-				"stroke:#000;stroke-width:1;stroke-dasharray:1 4")
+	// Draw the folds, in a fixed order so that the same model always
+	// gives the same SVG
+	if layer != "cut" {
+		startLayer(s, "score")
+		edges := m.edges()
+		for i := 0; i < len(edges); i++ {
+			if e := edges[i]; m.internal[e.Q] {
+				s.Line(e.Org().X, e.Org().Y,
+					e.Dest().X, e.Dest().Y,
+					m.foldStyle(e))
+			}
+		}
+		s.Gend()
+	}
+
+	if printCursor {
+		e := e0
+		if m.reversed {
+			e = e.Sym()
+		}
+		s.Line(e.Org().X, e.Org().Y,
+			e.Dest().X, e.Dest().Y,
+			"marker-end='url(#Triangle)' style='stroke:#f00;stroke-width:2'")
+	}
+
+	if printCursor {
+		// Vertices on the perimeter, coloured by whether they can
+		// still fold up
+		for _, v := range m.vertexAngles() {
+			s.Circle(v.e.Org().X, v.e.Org().Y, m.paper.PolygonSide/25,
+				fmt.Sprintf("stroke:none;fill:%s;pointer-events:none", vertexColors[v.state]))
+		}
+	}
+
+	if printLabels && layer == "" {
+		// Matching labels on edges that are glued together, in a
+		// group of their own so that they can be left out when cutting
+		labels := m.glueLabels()
+		splits := m.splitLabels()
+		if len(labels) > 0 || len(splits) > 0 {
+			numbered := m.edges()
+			s.Gid("labels")
+			for _, l := range labels {
+				e := numbered[l.index]
+				if l.sym {
+					e = e.Sym()
+				}
+				drawLabel(s, e, l.tab, strconv.Itoa(l.label))
+			}
+			for _, l := range splits {
+				drawLabel(s, l.e, l.tab, l.label)
+			}
+			s.Gend()
+		}
+	}
+
+	if pending != nil {
+		// Faces that the pending polygon would overlap are red
+		for _, face := range m.overlaps(pending) {
+			pathbuf.Reset()
+			fmt.Fprintf(pathbuf, "M %f %f", face[0].X, face[0].Y)
+			for _, p := range face[1:] {
+				fmt.Fprintf(pathbuf, "L %f %f", p.X, p.Y)
+			}
+			fmt.Fprintf(pathbuf, "z")
+			s.Path(string(pathbuf.Bytes()), "stroke:none;fill:#f00;fill-opacity:0.4")
+		}
+		// Draw the pending polygon, with the edge it attaches by
+		pathbuf.Reset()
+		fmt.Fprintf(pathbuf, "M %f %f", pending.Org().X, pending.Org().Y)
+		for e := pending.Lnext(); *e != *pending; e = e.Lnext() {
+			fmt.Fprintf(pathbuf, "L %f %f", e.Org().X, e.Org().Y)
 		}
+		fmt.Fprintf(pathbuf, "z")
+		s.Path(string(pathbuf.Bytes()), "stroke:#00f;stroke-width:1;fill:#00f;fill-opacity:0.15")
+		s.Line(pending.Org().X, pending.Org().Y,
+			pending.Dest().X, pending.Dest().Y,
+			"stroke:#00f;stroke-width:3")
 	}
 	if shift {
 		s.Gend()
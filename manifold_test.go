@@ -0,0 +1,539 @@
+package main
+
+import (
+	"./polyhedra"
+	. "./quadedge"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// pairSet describes the edges glued together by the positions of their
+// ends, so that gluings of nets built separately can be compared.
+func pairSet(g *gluing) []string {
+	var pairs []string
+	for a, b := range g.partner {
+		if a < b {
+			pairs = append(pairs, a+" = "+b)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// A net of a solid from the catalog should fold back into that solid,
+// with the edges that were cut to unfold it glued together again, and
+// the same way every time.
+func TestFoldCatalog(t *testing.T) {
+	names := append(polyhedra.Names(), "prism-7", "antiprism-8", "aC", "tT")
+	for _, name := range names {
+		m := NewModel()
+		if err := m.command("solid(" + name + ")"); err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		net := m.net()
+		if m.gluing(net) == nil {
+			t.Errorf("%s: no gluing from the solid", name)
+			continue
+		}
+		want := pairSet(m.glue)
+		if 2*len(want) != len(net.Boundary) {
+			t.Errorf("%s: %d pairs of edges glued for %d boundary edges", name, len(want), len(net.Boundary))
+		}
+
+		var first string
+		for try := 0; try < 2; try++ {
+			m.glue = nil // search for the gluing, rather than take the solid's
+			_, solid, err := m.fold()
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+				break
+			}
+			if got := pairSet(m.glue); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: glued\n%v\nwant\n%v", name, got, want)
+			}
+			s := fmt.Sprint(solid.Pairs, solid.Faces, solid.Vertices)
+			if try == 0 {
+				first = s
+			} else if s != first {
+				t.Errorf("%s: folds differently the second time", name)
+			}
+		}
+	}
+}
+
+// T puts one tab on each pair of edges that are glued together.
+func TestTabsCatalog(t *testing.T) {
+	for _, name := range []string{"cube", "snub-cube", "prism-40", "antiprism-40"} {
+		m := NewModel()
+		if err := m.command("solid(" + name + ") T"); err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		labels, tabs := make(map[int]int), make(map[int]int)
+		for _, l := range m.glueLabels() {
+			labels[l.label]++
+			if l.tab {
+				tabs[l.label]++
+			}
+		}
+		if pairs := len(pairSet(m.glue)); len(labels) != pairs {
+			t.Errorf("%s: %d labels for %d pairs of edges", name, len(labels), pairs)
+		}
+		for label := range labels {
+			if tabs[label] != 1 {
+				t.Errorf("%s: %d tabs for the edges labelled %d", name, tabs[label], label)
+			}
+		}
+	}
+}
+
+const (
+	tetraOBJ = "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 0 0 1\nf 1 3 2\nf 1 2 4\nf 1 4 3\nf 2 3 4\n"
+	cubeOBJ  = "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nv 0 0 1\nv 1 0 1\nv 1 1 1\nv 0 1 1\n" +
+		"f 1 4 3 2\nf 5 6 7 8\nf 1 2 6 5\nf 2 3 7 6\nf 3 4 8 7\nf 4 1 5 8\n"
+)
+
+// A mesh imported under the name of another keeps its own name, so that
+// undo and redo rebuild the earlier import with the earlier mesh.
+func TestImportSameName(t *testing.T) {
+	m := NewModel()
+	for _, step := range []struct {
+		obj   string
+		name  string // the name it is imported by
+		faces int
+	}{
+		{tetraOBJ, "x.obj", 4},
+		{cubeOBJ, "x-2.obj", 6},
+		{tetraOBJ, "x.obj", 4},
+		{cubeOBJ, "x-2.obj", 6},
+	} {
+		if err := m.importFile("dir/x.obj", []byte(step.obj), m.interactive); err != nil {
+			t.Fatal(err)
+		}
+		if h := m.current.cmd; h != "import("+step.name+")" {
+			t.Errorf("imported as %s, want import(%s)", h, step.name)
+		}
+		if n := len(m.net().Faces); n != step.faces {
+			t.Errorf("%d faces after %s, want %d", n, m.current.cmd, step.faces)
+		}
+		m.command("f")
+	}
+	if len(m.meshes) != 2 {
+		t.Errorf("%d meshes, want 2", len(m.meshes))
+	}
+	for _, want := range []int{6, 4, 4, 6, 6, 4, 4} {
+		m.command("u")
+		if n := len(m.net().Faces); n != want {
+			t.Errorf("%d faces after undo to %s, want %d", n, m.current.cmd, want)
+		}
+	}
+
+	m = NewModel()
+	twoPieces := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 5 0 0\nv 6 0 0\nv 5 1 0\nf 1 2 3\nf 4 5 6\n"
+	if err := m.importFile("x.obj", []byte(twoPieces), m.interactive); err == nil {
+		t.Error("no error for a mesh in two pieces")
+	}
+	if len(m.meshes) != 0 || m.current != m.undoRoot {
+		t.Errorf("%d meshes and history %q after a failed import", len(m.meshes), m.history())
+	}
+}
+
+// Errors can quote a project file, which could come from anyone, so the
+// page must get them escaped.
+func TestProjectErrorEscaped(t *testing.T) {
+	data, err := NewModel().saveProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make(map[string]interface{})
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	p["meshes"] = map[string]string{"<img src=x onerror=alert(1)>": "not a mesh"}
+	if data, err = json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	Project(w, httptest.NewRequest("POST", "/project?s=escape", strings.NewReader(string(data))))
+	if body := w.Body.String(); w.Code == 200 || strings.Contains(body, "<img") || !strings.Contains(body, "&lt;img") {
+		t.Errorf("got %d %q, want an error with the name escaped", w.Code, body)
+	}
+}
+
+// A saved project loads back into the same model, cursor and all.
+func TestProjectRoundTrip(t *testing.T) {
+	for _, prog := range []string{
+		"",
+		"4 f2 4 (b2 4)x2 f 4 f3 4 t*",
+		"5 5 r 5 t(notched) f t tabs(zigzag,5mm) t b2",
+		"6 3@1 rect(2)~ p 4 e x",
+		"4 4 u 5 f V",
+		"solid(cube) T",
+	} {
+		m := NewModel()
+		if err := m.command(prog); err != nil {
+			t.Errorf("%s: %s", prog, err)
+			continue
+		}
+		data, err := m.saveProject()
+		if err != nil {
+			t.Errorf("%s: %s", prog, err)
+			continue
+		}
+		m2 := NewModel()
+		m2.command("3 3")
+		if err := m2.loadProject(data); err != nil {
+			t.Errorf("%s: %s", prog, err)
+			continue
+		}
+		if again, _ := m2.saveProject(); string(again) != string(data) {
+			t.Errorf("%s: saved\n%s\nloaded as\n%s", prog, data, again)
+		}
+		if string(m2.draw(nil)) != string(m.draw(nil)) {
+			t.Errorf("%s: draws differently once loaded", prog)
+		}
+	}
+}
+
+// A project that doesn't match its history, or would put the model in a
+// state that it can't get into by itself, is refused, and the model is
+// left as it was.
+func TestProjectRejected(t *testing.T) {
+	m := NewModel()
+	if err := m.command("4 4 4 f t f"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.saveProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var internal, tab int
+	for i, e := range m.edges() {
+		switch {
+		case m.tabEdge[e.Q]:
+			tab = i
+		case m.internal[e.Q]:
+			internal = i
+		}
+	}
+	for _, tt := range []struct {
+		name   string
+		change func(p *project)
+	}{
+		{"cursor on an internal edge", func(p *project) { p.Cursor = &projectEdge{Index: internal} }},
+		{"cursor on a tab", func(p *project) { p.Cursor = &projectEdge{Index: tab} }},
+		{"cursor the wrong way round", func(p *project) { p.Cursor.Sym = !p.Cursor.Sym }},
+		{"cursor on no edge", func(p *project) { p.Cursor.Index = 1000 }},
+		{"edge with a tab that isn't", func(p *project) { p.Edges[tab].Tab = false }},
+		{"edge that isn't there", func(p *project) { p.Edges[0].Index = 1000 }},
+		{"edge missing", func(p *project) { p.Edges = p.Edges[1:] }},
+		{"bad history", func(p *project) { p.History += " !" }},
+		{"history that fails", func(p *project) { p.History = "import(x.obj)" }},
+		{"bad version", func(p *project) { p.Version = 99 }},
+		{"bad paper", func(p *project) { p.Paper.Units = "furlong" }},
+		{"bad margin", func(p *project) { p.Paper.Margin = p.Paper.Width }},
+		{"bad mesh", func(p *project) { p.Meshes = map[string]string{"x.obj": "v 0 0 0\n"} }},
+	} {
+		p := new(project)
+		if err := json.Unmarshal(data, p); err != nil {
+			t.Fatal(err)
+		}
+		tt.change(p)
+		bad, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2 := NewModel()
+		m2.command("3 f 3")
+		before, _ := m2.saveProject()
+		if err := m2.loadProject(bad); err == nil {
+			t.Errorf("%s: loaded", tt.name)
+		}
+		if after, _ := m2.saveProject(); string(after) != string(before) {
+			t.Errorf("%s: model changed", tt.name)
+		}
+	}
+	if err := NewModel().loadProject([]byte("{")); err == nil {
+		t.Error("loaded a file that isn't JSON")
+	}
+}
+
+// t refuses a tab that can't be made small enough to keep off the rest
+// of the net, unless it is given a style, and then it adds it anyway.
+func TestTabNoFit(t *testing.T) {
+	m := NewModel()
+	if err := m.command("12 8 b 12 f"); err != nil { // the second 12-gon overlaps the 8-gon
+		t.Fatal(err)
+	}
+	e, history := m.e0, m.history()
+	if err := m.interactive("t"); err == nil || !strings.HasPrefix(err.Error(), "No tab fits") {
+		t.Errorf("t gave %v, want No tab fits...", err)
+	}
+	if m.history() != history || m.e0 != e || m.internal[e.Q] {
+		t.Errorf("history %q after t failed, want %q", m.history(), history)
+	}
+	if err := m.interactive("t(plain)"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.internal[e.Q] {
+		t.Error("t(plain) added no tab")
+	}
+}
+
+// A click that attaches a polygon moves the cursor and attaches it
+// together, or, if the polygon would overlap the net, does neither.
+func TestCursorClick(t *testing.T) {
+	req := httptest.NewRequest("POST", "/cursor?s=click", nil)
+	m, err := sessionModel(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.command("12 8 b"); err != nil { // a 12-gon at the cursor would overlap the 8-gon
+		t.Fatal(err)
+	}
+	edges := m.edges()
+	edge := -1
+	for i, e := range edges {
+		if e.Q == m.e0.Q {
+			edge = i
+		}
+	}
+	m.command("f")
+	svg, history := string(m.draw(nil)), m.history()
+	for _, tt := range []struct {
+		sides string
+		ok    bool
+	}{
+		{"12", false},
+		{"x", false},
+		{"3", true},
+	} {
+		w := httptest.NewRecorder()
+		Cursor(w, httptest.NewRequest("POST", fmt.Sprintf("/cursor?s=click&edge=%d&sides=%s", edge, tt.sides), nil))
+		if ok := w.Code == 200; ok != tt.ok {
+			t.Errorf("sides %s: got %d %q", tt.sides, w.Code, w.Body.String())
+		}
+		if !tt.ok && (string(m.draw(nil)) != svg || m.history() != history) {
+			t.Errorf("sides %s: history %q after the click failed, want %q", tt.sides, m.history(), history)
+		}
+	}
+	if want := fmt.Sprintf("%s edge(%d) 3", history, edge); m.history() != want {
+		t.Errorf("history %q, want %q", m.history(), want)
+	}
+}
+
+// Undo and redo start from the nearest snapshot, and must end up with
+// the same net and cursor as running the history from scratch.
+func TestUndoSnapshots(t *testing.T) {
+	cmds := strings.Fields("4 4 f 3 t 5 b 6 r f2 3 t 8 b2 4 tabs(zigzag) t 3 V f 4 r t2 6 b 3 f3 t(notched) b 3 V f 6 t 3 4 b 4")
+	m := NewModel()
+	for _, cmd := range cmds {
+		if err := m.command(cmd); err != nil {
+			t.Fatalf("%s: %s", cmd, err)
+		}
+	}
+	if len(cmds) <= 2*snapshotInterval || m.current.depth != len(cmds) {
+		t.Fatalf("%d commands at depth %d, want more than %d", len(cmds), m.current.depth, 2*snapshotInterval)
+	}
+	check := func(n int) {
+		fresh := NewModel()
+		fresh.command(strings.Join(cmds[:n], " "))
+		if m.history() != fresh.history() || string(m.draw(nil)) != string(fresh.draw(nil)) {
+			t.Errorf("at %q, draws differently from a fresh replay", m.history())
+		}
+	}
+	for n := len(cmds) - 1; n >= 0; n-- {
+		m.command("u")
+		check(n)
+	}
+	for n := 1; n <= len(cmds); n++ {
+		m.command("U")
+		check(n)
+	}
+	snaps := 0
+	for n := m.current; n != nil; n = n.parent {
+		if n.snap != nil {
+			snaps++
+		}
+	}
+	if snaps != len(cmds)/snapshotInterval {
+		t.Errorf("%d snapshots for %d commands", snaps, len(cmds))
+	}
+}
+
+// Undo keeps what was undone as a branch of the undo tree: redo follows
+// the branch last taken, a command that was undone before takes its old
+// branch again, and jumping to any node rebuilds the net as it was there.
+func TestUndoTree(t *testing.T) {
+	req := httptest.NewRequest("POST", "/history?s=tree", nil)
+	m, err := sessionModel(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var three *undoNode
+	for _, step := range []struct {
+		prog, history string
+	}{
+		{"4 4 3", "4 4 3"},
+		{"u", "4 4"},
+		{"U", "4 4 3"},
+		{"u 5 f", "4 4 5 f"},
+		{"u2", "4 4"},
+		{"U", "4 4 5"},
+		{"u 3", "4 4 3"}, // the old branch, not a new one
+		{"u U", "4 4 3"},
+		{"U", "4 4 3"}, // nothing to redo
+		{"u2 b", "4 b"},
+		{"u 4 5", "4 4 5"},
+		{"U", "4 4 5 f"},
+	} {
+		if err := m.command(step.prog); err != nil {
+			t.Fatalf("%s: %s", step.prog, err)
+		}
+		if h := m.history(); h != step.history {
+			t.Fatalf("after %s, history %q, want %q", step.prog, h, step.history)
+		}
+		fresh := NewModel()
+		fresh.command(step.history)
+		if string(m.draw(nil)) != string(fresh.draw(nil)) {
+			t.Errorf("after %s, draws differently from a fresh %s", step.prog, step.history)
+		}
+		if step.history == "4 4 3" {
+			if three != nil && m.current != three {
+				t.Errorf("after %s, a new node for 3", step.prog)
+			}
+			three = m.current
+		}
+	}
+	if n := len(m.undoNodes); n != 7 {
+		t.Errorf("%d nodes in the undo tree, want 7", n)
+	}
+
+	// jumping to another branch, and redo back along it
+	for _, tt := range []struct {
+		node    int
+		code    int
+		history string
+	}{
+		{three.id, 200, "4 4 3"},
+		{three.parent.parent.id, 200, "4"},
+		{len(m.undoNodes), 404, "4"},
+	} {
+		w := httptest.NewRecorder()
+		History(w, httptest.NewRequest("POST", fmt.Sprintf("/history?s=tree&node=%d", tt.node), nil))
+		if w.Code != tt.code || m.history() != tt.history {
+			t.Errorf("node %d: got %d and history %q, want %d and %q", tt.node, w.Code, m.history(), tt.code, tt.history)
+		}
+	}
+	if m.command("U U"); m.history() != "4 4 3" {
+		t.Errorf("redo after jumping to 4 gave %q, want 4 4 3", m.history())
+	}
+}
+
+// tabOutline returns the corners of the tab on the perimeter edge e, in
+// the coordinates of tabPoints, where e runs from (0, 0) to (4, 0).
+func tabOutline(e *Edge) [][2]float64 {
+	pts := points(e.Sym()) // the tab is on the other side of e
+	a, b := pts[0], pts[1]
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l2 := (dx*dx + dy*dy) / 4
+	var out [][2]float64
+	for _, p := range pts {
+		x, y := p.X-a.X, p.Y-a.Y
+		out = append(out, [2]float64{(x*dx + y*dy) / l2, (dx*y - dy*x) / l2})
+	}
+	return out
+}
+
+// Each style draws the tab it describes, on an edge 4 long, with its
+// arguments defaulting to the model's tab style.
+func TestTabStyles(t *testing.T) {
+	cot60 := 1 / math.Sqrt(3)
+	for _, tt := range []struct {
+		prog string
+		want [][2]float64 // nil to check only the number of corners
+		n    int
+	}{
+		{"t", [][2]float64{{0, 0}, {4, 0}, {3, 1}, {1, 1}}, 0},
+		{"t(plain,0.125)", [][2]float64{{0, 0}, {4, 0}, {3.5, 0.5}, {0.5, 0.5}}, 0},
+		{"t(plain,,60)", [][2]float64{{0, 0}, {4, 0}, {4 - cot60, 1}, {cot60, 1}}, 0},
+		{"t(notched)", [][2]float64{{0, 0}, {4, 0}, {3, 1}, {2.25, 1}, {2, 1.0 / 3}, {1.75, 1}, {1, 1}}, 0},
+		{"t(zigzag)", [][2]float64{{0, 0}, {4, 0}, {3, 1},
+			{2.75, 0.75}, {2.5, 1}, {2.25, 0.75}, {2, 1}, {1.75, 0.75}, {1.5, 1}, {1.25, 0.75}, {1, 1}}, 0},
+		{"t(slot)", [][2]float64{{0, 0}, {4, 0}, {3, 0.15}, {3, 0.5}, {3.4, 0.5}, {2.8, 1}, {1.2, 1}, {0.6, 0.5}, {1, 0.5}, {1, 0.15}}, 0},
+		{"t(plain,0.75)", [][2]float64{{0, 0}, {4, 0}, {2, 2}}, 0}, // too high to have a top, so a triangle
+		{"t(plain,,,0.5)", nil, 2 + 2*9}, // arcs of 8 steps for C and D
+		{"tabs(notched,0.125) t", [][2]float64{{0, 0}, {4, 0}, {3.5, 0.5}, {2.125, 0.5}, {2, 1.0 / 6}, {1.875, 0.5}, {0.5, 0.5}}, 0},
+		{"tabs(zigzag,0.5) t(plain)", [][2]float64{{0, 0}, {4, 0}, {2, 2}}, 0},
+		{"tabs(slot) tabs() t", [][2]float64{{0, 0}, {4, 0}, {3, 1}, {1, 1}}, 0},
+	} {
+		m := NewModel()
+		m.command("4")
+		e := m.e0
+		if err := m.command(tt.prog); err != nil {
+			t.Errorf("%s: %s", tt.prog, err)
+			continue
+		}
+		if !m.internal[e.Q] {
+			t.Errorf("%s: no tab", tt.prog)
+			continue
+		}
+		got := tabOutline(e)
+		if tt.want == nil {
+			if len(got) != tt.n {
+				t.Errorf("%s: %d corners, want %d", tt.prog, len(got), tt.n)
+			}
+			continue
+		}
+		ok := len(got) == len(tt.want)
+		for i := 0; ok && i < len(got); i++ {
+			ok = math.Abs(got[i][0]-tt.want[i][0]) < 1e-9 && math.Abs(got[i][1]-tt.want[i][1]) < 1e-9
+		}
+		if !ok {
+			t.Errorf("%s: corners %v, want %v", tt.prog, got, tt.want)
+		}
+	}
+
+	// an absolute height is the same whatever the length of the edge
+	m := NewModel()
+	m.command("4")
+	e := m.e0
+	m.command("t(plain,5mm)")
+	if h, want := tabOutline(e)[2][1], 4*m.tabHeight(edgeLength(e), TabStyle{Height: 5, Units: "mm"}); math.Abs(h-want) > 1e-9 {
+		t.Errorf("t(plain,5mm): height %g, want %g", h, want)
+	}
+
+	for _, tt := range []struct {
+		prog, err string // start of the error
+	}{
+		{"t(round)", "No tab shape round; try plain, notched, zigzag, slot"},
+		{"t(plain,0)", "t: bad height 0"},
+		{"t(plain,1.5)", "t: bad height 1.5"},
+		{"t(plain,x)", "t: bad height x"},
+		{"t(plain,5furlong)", "t: bad height 5furlong"},
+		{"tabs(plain,-2mm)", "tabs: bad height -2mm"},
+		{"t(plain,,90)", "t: the angle must be between 0 and 90 degrees"},
+		{"t(plain,,0)", "t: the angle must be between 0 and 90 degrees"},
+		{"t(plain,,,1.5)", "t: the radius must be between 0 and 1"},
+		{"tabs(plain,,,-1)", "tabs: the radius must be between 0 and 1"},
+		{"t(plain,0.2,45,0,1)", "t takes a shape, height, angle and radius"},
+		{"tabs(zigzag)2", "tabs(zigzag)2 can't be repeated"},
+	} {
+		m := NewModel()
+		m.command("4")
+		err := m.interactive(tt.prog)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want %s...", tt.prog, err, tt.err)
+		}
+		if m.history() != "4" || m.tabStyle != defaultTabStyle {
+			t.Errorf("%s: history %q and tab style %v after an error", tt.prog, m.history(), m.tabStyle)
+		}
+	}
+}
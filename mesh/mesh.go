@@ -0,0 +1,787 @@
+package mesh
+
+import (
+	"../fold"
+	"../geom"
+	. "../quadedge"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* Polygon meshes, as made by 3D modelling programs, and unfolding them.
+
+   A mesh is read from an OBJ, OFF or STL (ASCII or binary) file.  Only
+   the shape is kept: vertices, and faces as lists of vertices.  The
+   faces of a closed mesh are turned so that they are all CCW seen from
+   outside, whichever way they were in the file.
+
+   Unfolding cuts the mesh along some of its edges so that it can be
+   laid flat.  The edges that aren't cut form a spanning tree of the
+   faces: each face but the root is attached to its parent by one edge.
+*/
+
+// A Mesh is a polyhedral surface.
+type Mesh struct {
+	Vertices []fold.Point3D
+	Faces    [][]int // vertices of each face, in order
+}
+
+// Limits on the size of a mesh, so that a stray file can't run the
+// server out of memory.
+var (
+	MaxFaces    = 20000
+	MaxVertices = 60000
+)
+
+// Read reads a mesh in the format given by the extension of name: .obj,
+// .off or .stl.
+func Read(name string, data []byte) (*Mesh, error) {
+	var m *Mesh
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".obj":
+		m, err = ReadOBJ(bytes.NewReader(data))
+	case ".off":
+		m, err = ReadOFF(bytes.NewReader(data))
+	case ".stl":
+		m, err = ReadSTL(data)
+	default:
+		return nil, fmt.Errorf("%s: not an OBJ, OFF or STL file", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return m, nil
+}
+
+// add adds a face, leaving out repeated vertices, and checks the limits.
+func (m *Mesh) add(face []int) error {
+	var f []int
+	for i, v := range face {
+		if v < 0 || v >= len(m.Vertices) {
+			return fmt.Errorf("no vertex %d", v+1)
+		}
+		if v != face[(i+1)%len(face)] {
+			f = append(f, v)
+		}
+	}
+	if len(f) < 3 {
+		return nil // degenerate
+	}
+	if m.flat(f) {
+		return errors.New("face has no area")
+	}
+	if len(m.Faces) >= MaxFaces {
+		return fmt.Errorf("more than %d faces", MaxFaces)
+	}
+	m.Faces = append(m.Faces, f)
+	return nil
+}
+
+// flat reports whether a face has no area to speak of, since its corners
+// are all in a line, as in the slivers that some programs leave in STL
+// files.  Such a face has no normal, so it can't be laid flat.
+func (m *Mesh) flat(face []int) bool {
+	longest := 0.0
+	for k, i := range face {
+		longest = math.Max(longest, m.Vertices[face[(k+1)%len(face)]].Sub(m.Vertices[i]).Length())
+	}
+	return fold.Area(m.Vertices, face) <= 1e-9*longest*longest
+}
+
+func (m *Mesh) vertex(fields []string) error {
+	if len(fields) < 3 {
+		return errors.New("vertex needs three coordinates")
+	}
+	if len(m.Vertices) >= MaxVertices {
+		return fmt.Errorf("more than %d vertices", MaxVertices)
+	}
+	var c [3]float64
+	for i := range c {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("bad coordinate %q", fields[i])
+		}
+		c[i] = f
+	}
+	m.Vertices = append(m.Vertices, fold.Point3D{c[0], c[1], c[2]})
+	return nil
+}
+
+// ReadOBJ reads a Wavefront OBJ file.  Everything but vertices and faces
+// is ignored.
+func ReadOBJ(r io.Reader) (*Mesh, error) {
+	m := new(Mesh)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "v":
+			err = m.vertex(fields[1:])
+		case "f":
+			face := make([]int, len(fields)-1)
+			for i, field := range fields[1:] {
+				// v, v/vt, v//vn or v/vt/vn; negative counts back from the end
+				n, err1 := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+				if err1 != nil || n == 0 {
+					err = fmt.Errorf("bad vertex %q", field)
+					break
+				}
+				if n < 0 {
+					n += len(m.Vertices) + 1
+				}
+				face[i] = n - 1
+			}
+			if err == nil {
+				err = m.add(face)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, m.check()
+}
+
+// ReadOFF reads an Object File Format file.
+func ReadOFF(r io.Reader) (*Mesh, error) {
+	m := new(Mesh)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	next := func() []string { // the next line that isn't empty or a comment
+		for scanner.Scan() {
+			line++
+			text := scanner.Text()
+			if i := strings.IndexByte(text, '#'); i >= 0 {
+				text = text[:i]
+			}
+			if fields := strings.Fields(text); len(fields) > 0 {
+				return fields
+			}
+		}
+		return nil
+	}
+	fields := next()
+	if len(fields) == 0 || !strings.HasSuffix(fields[0], "OFF") {
+		return nil, errors.New("missing OFF header")
+	}
+	fields = fields[1:] // the counts may follow on the same line
+	if len(fields) == 0 {
+		fields = next()
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("line %d: missing counts", line)
+	}
+	nv, err1 := strconv.Atoi(fields[0])
+	nf, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || nv < 0 || nf < 0 {
+		return nil, fmt.Errorf("line %d: bad counts", line)
+	}
+	if nv > MaxVertices || nf > MaxFaces {
+		return nil, fmt.Errorf("more than %d vertices or %d faces", MaxVertices, MaxFaces)
+	}
+	for i := 0; i < nv; i++ {
+		if err := m.vertex(next()); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	for i := 0; i < nf; i++ {
+		fields := next()
+		n := -1
+		if len(fields) > 0 {
+			n, _ = strconv.Atoi(fields[0])
+		}
+		if n < 0 || len(fields) < n+1 {
+			return nil, fmt.Errorf("line %d: bad face", line)
+		}
+		face := make([]int, n)
+		for j := range face {
+			v, err := strconv.Atoi(fields[j+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad vertex %q", line, fields[j+1])
+			}
+			face[j] = v
+		}
+		if err := m.add(face); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, m.check()
+}
+
+// ReadSTL reads an STL file, ASCII or binary.  STL files list each
+// triangle with its own copies of its corners, so corners in the same
+// place are made into one vertex.
+func ReadSTL(data []byte) (*Mesh, error) {
+	m := new(Mesh)
+	index := make(map[fold.Point3D]int)
+	corner := func(p fold.Point3D) (int, error) {
+		if i, ok := index[p]; ok {
+			return i, nil
+		}
+		if len(m.Vertices) >= MaxVertices {
+			return 0, fmt.Errorf("more than %d vertices", MaxVertices)
+		}
+		index[p] = len(m.Vertices)
+		m.Vertices = append(m.Vertices, p)
+		return index[p], nil
+	}
+	if len(data) >= 84 && uint64(len(data)) == 84+50*uint64(binary.LittleEndian.Uint32(data[80:84])) {
+		// binary: 80 byte header, count, then per triangle a normal,
+		// three corners and two bytes of attributes
+		for n, t := 1, data[84:]; len(t) >= 50; n, t = n+1, t[50:] {
+			face := make([]int, 3)
+			for k := range face {
+				var c [3]float64
+				for j := range c {
+					c[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(t[12+12*k+4*j:])))
+					if math.IsNaN(c[j]) || math.IsInf(c[j], 0) {
+						return nil, fmt.Errorf("triangle %d: bad coordinate %g", n, c[j])
+					}
+				}
+				i, err := corner(fold.Point3D{c[0], c[1], c[2]})
+				if err != nil {
+					return nil, err
+				}
+				face[k] = i
+			}
+			if err := m.add(face); err != nil {
+				return nil, fmt.Errorf("triangle %d: %s", n, err)
+			}
+		}
+		return m, m.check()
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return nil, errors.New("not an STL file")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var face []int
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "outer":
+			face = nil
+		case "vertex":
+			var c [3]float64
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: vertex needs three coordinates", line)
+			}
+			for j := range c {
+				f, err := strconv.ParseFloat(fields[j+1], 64)
+				if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+					return nil, fmt.Errorf("line %d: bad coordinate %q", line, fields[j+1])
+				}
+				c[j] = f
+			}
+			i, err := corner(fold.Point3D{c[0], c[1], c[2]})
+			if err != nil {
+				return nil, err
+			}
+			face = append(face, i)
+		case "endloop":
+			if err := m.add(face); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, m.check()
+}
+
+func (m *Mesh) check() error {
+	if len(m.Faces) == 0 {
+		return errors.New("no faces")
+	}
+	return nil
+}
+
+// WriteOBJ writes the mesh as a Wavefront OBJ file.
+func (m *Mesh) WriteOBJ(w io.Writer) error {
+	for _, p := range m.Vertices {
+		if _, err := fmt.Fprintf(w, "v %g %g %g\n", p.X, p.Y, p.Z); err != nil {
+			return err
+		}
+	}
+	for _, f := range m.Faces {
+		line := "f"
+		for _, i := range f {
+			line += fmt.Sprintf(" %d", i+1)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A FaceEdge is an edge of a face: the edge from Faces[Face][K] to the
+// next vertex.
+type FaceEdge struct {
+	Face, K int
+}
+
+// Next returns the index in Faces[f] of the vertex after the kth.
+func (m *Mesh) Next(f, k int) int {
+	return (k + 1) % len(m.Faces[f])
+}
+
+// Neighbors returns, for the kth edge of each face, the edge of another
+// face that shares it, or FaceEdge{-1, -1} if there isn't one.  It is an
+// error for more than two faces to share an edge.
+func (m *Mesh) Neighbors() ([][]FaceEdge, error) {
+	type pair struct{ u, v int }
+	edges := make(map[pair][]FaceEdge)
+	for f, face := range m.Faces {
+		for k, u := range face {
+			v := face[m.Next(f, k)]
+			p := pair{u, v}
+			if u > v {
+				p = pair{v, u}
+			}
+			edges[p] = append(edges[p], FaceEdge{f, k})
+		}
+	}
+	nbrs := make([][]FaceEdge, len(m.Faces))
+	for f, face := range m.Faces {
+		nbrs[f] = make([]FaceEdge, len(face))
+		for k, u := range face {
+			v := face[m.Next(f, k)]
+			p := pair{u, v}
+			if u > v {
+				p = pair{v, u}
+			}
+			switch es := edges[p]; len(es) {
+			case 1:
+				nbrs[f][k] = FaceEdge{-1, -1}
+			case 2:
+				nbrs[f][k] = es[0]
+				if es[0] == (FaceEdge{f, k}) {
+					nbrs[f][k] = es[1]
+				}
+			default:
+				return nil, fmt.Errorf("more than two faces meet at the edge from vertex %d to %d", u+1, v+1)
+			}
+		}
+	}
+	return nbrs, nil
+}
+
+// Orient turns the faces so that neighbors agree on which way round
+// they go, and so that a closed mesh has them CCW seen from outside.
+func (m *Mesh) Orient() error {
+	nbrs, err := m.Neighbors()
+	if err != nil {
+		return err
+	}
+	done := make([]bool, len(m.Faces))
+	flipped := make([]bool, len(m.Faces))
+	for start := range m.Faces {
+		if done[start] {
+			continue
+		}
+		done[start] = true
+		queue := []int{start}
+		for len(queue) > 0 {
+			f := queue[0]
+			queue = queue[1:]
+			for k, n := range nbrs[f] {
+				if n.Face < 0 {
+					continue
+				}
+				// neighbors go the same way round if they run along
+				// the shared edge in opposite directions
+				same := m.Faces[f][k] == m.Faces[n.Face][n.K]
+				if done[n.Face] {
+					if same != (flipped[f] != flipped[n.Face]) {
+						return errors.New("the mesh is one-sided, like a Moebius strip")
+					}
+					continue
+				}
+				done[n.Face] = true
+				flipped[n.Face] = same != flipped[f]
+				queue = append(queue, n.Face)
+			}
+		}
+	}
+	for f, flip := range flipped {
+		if flip {
+			reverse(m.Faces[f])
+		}
+	}
+	if fold.Volume(m.Vertices, m.Faces) < 0 {
+		for _, face := range m.Faces {
+			reverse(face)
+		}
+	}
+	return nil
+}
+
+func reverse(face []int) {
+	for i, j := 0, len(face)-1; i < j; i, j = i+1, j-1 {
+		face[i], face[j] = face[j], face[i]
+	}
+}
+
+// Flatten returns the corners of face f in the plane, CCW, with the
+// first corner at the origin and the first edge along the X axis.
+func (m *Mesh) Flatten(f int) []*Point2D {
+	face := m.Faces[f]
+	p0 := m.Vertices[face[0]]
+	u := m.Vertices[face[1]].Sub(p0)
+	u = u.Scale(1 / u.Length())
+	w := m.normal(f).Cross(u)
+	pts := make([]*Point2D, len(face))
+	for k, i := range face {
+		d := m.Vertices[i].Sub(p0)
+		pts[k] = &Point2D{d.Dot(u), d.Dot(w)}
+	}
+	return pts
+}
+
+// normal returns the unit normal of face f, which points out of the
+// mesh once it is oriented.
+func (m *Mesh) normal(f int) fold.Point3D {
+	return fold.Normal(m.Vertices, m.Faces[f])
+}
+
+// Reflex reports, for the kth edge of each face, whether the faces that
+// share it meet at more than 180° inside the mesh, so that it folds the
+// other way from the edges of a convex solid.  The mesh must be
+// oriented.
+func (m *Mesh) Reflex() ([][]bool, error) {
+	nbrs, err := m.Neighbors()
+	if err != nil {
+		return nil, err
+	}
+	epsilon := 1e-6 * m.EdgeLength()
+	reflex := make([][]bool, len(m.Faces))
+	for f, face := range m.Faces {
+		reflex[f] = make([]bool, len(face))
+		n := m.normal(f)
+		for k, nbr := range nbrs[f] {
+			if nbr.Face < 0 {
+				continue
+			}
+			// the neighbor's corners are in front of f if the edge
+			// is reflex, and behind it if it is convex
+			var d float64
+			for _, i := range m.Faces[nbr.Face] {
+				d += n.Dot(m.Vertices[i].Sub(m.Vertices[face[k]]))
+			}
+			reflex[f][k] = d/float64(len(m.Faces[nbr.Face])) > epsilon
+		}
+	}
+	return reflex, nil
+}
+
+// EdgeLength returns the average length of the edges of the mesh.
+func (m *Mesh) EdgeLength() float64 {
+	sum, n := 0.0, 0
+	for f, face := range m.Faces {
+		for k, i := range face {
+			sum += m.Vertices[face[m.Next(f, k)]].Sub(m.Vertices[i]).Length()
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// A Tree is a spanning tree of the faces of a mesh.  The mesh is
+// unfolded by cutting every edge that isn't in the tree.
+type Tree struct {
+	Order  []int      // the faces, parents before children
+	Parent []FaceEdge // the edge of each face's parent that it is attached to, or Face -1 for the root
+	Edge   []int      // the edge of each face that is attached to its parent
+
+	Strategy string  // how the tree was chosen
+	Cut      float64 // total length of the edges cut, other than the boundary of the mesh
+	Overlaps int     // number of pairs of faces that overlap when the mesh is laid out
+}
+
+// A hinge is an edge shared by two faces, which is either cut or kept
+// when the mesh is unfolded.
+type hinge struct {
+	a, b   FaceEdge // the two faces' sides of the edge
+	u, v   int      // its vertices
+	length float64
+}
+
+func (m *Mesh) hinges(nbrs [][]FaceEdge) []hinge {
+	var hs []hinge
+	for f, face := range m.Faces {
+		for k, n := range nbrs[f] {
+			if n.Face < f || n.Face == f && n.K < k {
+				continue // boundary, or seen from the other side
+			}
+			u, v := face[k], face[m.Next(f, k)]
+			hs = append(hs, hinge{FaceEdge{f, k}, n, u, v, m.Vertices[v].Sub(m.Vertices[u]).Length()})
+		}
+	}
+	return hs
+}
+
+// Restarts is the number of random directions and random spanning trees
+// that Unfold tries, besides the fixed ones.
+var Restarts = 20
+
+/* Unfolding strategies.  Each gives a weight to every hinge, and the
+   spanning tree is the one with the least total weight (Kruskal's
+   algorithm), so that hinges with low weights are kept and those with
+   high weights are cut.
+
+   Steepest edge: for a direction d, every vertex but the highest is cut
+   along its edge that climbs most steeply in direction d.  The cuts
+   form a tree that reaches every vertex, and for convex solids the
+   faces then tend to fan out from the cuts without overlapping.
+
+   Shortest cut: keep the longest hinges, so that the cuts are as short
+   as possible, which is less cutting and fewer tabs.
+
+   Random: random weights, for a random spanning tree.
+*/
+
+// steepestEdge returns the weights for steepest edge unfolding in
+// direction d: 1 for the hinges that are cut, 0 for the rest.
+func (m *Mesh) steepestEdge(hs []hinge, d fold.Point3D) []float64 {
+	best := make([]int, len(m.Vertices)) // hinge along which each vertex is cut, or -1
+	slope := make([]float64, len(m.Vertices))
+	for i := range best {
+		best[i] = -1
+	}
+	for i, h := range hs {
+		for _, uv := range [][2]int{{h.u, h.v}, {h.v, h.u}} {
+			s := m.Vertices[uv[1]].Sub(m.Vertices[uv[0]]).Dot(d) / h.length
+			if s > 0 && (best[uv[0]] < 0 || s > slope[uv[0]]) {
+				best[uv[0]], slope[uv[0]] = i, s
+			}
+		}
+	}
+	w := make([]float64, len(hs))
+	for _, i := range best {
+		if i >= 0 {
+			w[i] = 1
+		}
+	}
+	return w
+}
+
+func shortestCut(hs []hinge) []float64 {
+	w := make([]float64, len(hs))
+	for i, h := range hs {
+		w[i] = -h.length
+	}
+	return w
+}
+
+func random(hs []hinge, rnd *rand.Rand) []float64 {
+	w := make([]float64, len(hs))
+	for i := range w {
+		w[i] = rnd.Float64()
+	}
+	return w
+}
+
+// Unfold returns a spanning tree of the faces of a connected mesh.  It
+// tries each strategy, with several directions for steepest edge, and
+// picks the unfolding with the fewest overlapping faces, and of those
+// the one with the shortest cut.
+func (m *Mesh) Unfold() (*Tree, error) {
+	nbrs, err := m.Neighbors()
+	if err != nil {
+		return nil, err
+	}
+	hs := m.hinges(nbrs)
+	// the same mesh always unfolds the same way, so that histories
+	// that import it replay exactly
+	rnd := rand.New(rand.NewSource(1))
+	var best *Tree
+	try := func(strategy string, w []float64) error {
+		t, err := m.tree(hs, w)
+		if err != nil {
+			return err
+		}
+		t.Strategy = strategy
+		if best != nil && best.Overlaps == 0 && t.Cut >= best.Cut {
+			return nil // no better, whether it overlaps or not
+		}
+		limit := -1
+		if best != nil {
+			limit = best.Overlaps
+		}
+		t.Overlaps = countOverlaps(m.Layout(t), 1/m.EdgeLength(), limit)
+		if best == nil || t.Overlaps < best.Overlaps || t.Overlaps == best.Overlaps && t.Cut < best.Cut {
+			best = t
+		}
+		return nil
+	}
+	if err := try("shortest cut", shortestCut(hs)); err != nil {
+		return nil, err
+	}
+	dirs := []fold.Point3D{{0, 0, 1}, {0, 0, -1}, {0, 1, 0}, {0, -1, 0}, {1, 0, 0}, {-1, 0, 0}}
+	for i := 0; i < Restarts; i++ {
+		d := fold.Point3D{rnd.NormFloat64(), rnd.NormFloat64(), rnd.NormFloat64()}
+		dirs = append(dirs, d.Scale(1/d.Length()))
+	}
+	for _, d := range dirs {
+		try(fmt.Sprintf("steepest edge (%.2f, %.2f, %.2f)", d.X, d.Y, d.Z), m.steepestEdge(hs, d))
+	}
+	for i := 0; i < Restarts; i++ {
+		try("random", random(hs, rnd))
+	}
+	return best, nil
+}
+
+// tree returns the spanning tree that keeps the hinges of least total
+// weight, rooted at the face with the most sides.
+func (m *Mesh) tree(hs []hinge, w []float64) (*Tree, error) {
+	order := make([]int, len(hs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return w[order[i]] < w[order[j]] })
+	set := make([]int, len(m.Faces)) // union-find
+	for f := range set {
+		set[f] = f
+	}
+	find := func(f int) int {
+		for set[f] != f {
+			set[f] = set[set[f]]
+			f = set[f]
+		}
+		return f
+	}
+	t := &Tree{Parent: make([]FaceEdge, len(m.Faces)), Edge: make([]int, len(m.Faces))}
+	kept := make([][]hinge, len(m.Faces)) // hinges kept, with each face's own side as a
+	for _, i := range order {
+		h := hs[i]
+		a, b := find(h.a.Face), find(h.b.Face)
+		if a == b {
+			t.Cut += h.length
+			continue
+		}
+		set[a] = b
+		kept[h.a.Face] = append(kept[h.a.Face], h)
+		kept[h.b.Face] = append(kept[h.b.Face], hinge{a: h.b, b: h.a})
+	}
+	root := 0
+	for f, face := range m.Faces {
+		if len(face) > len(m.Faces[root]) {
+			root = f
+		}
+	}
+	for f := range t.Parent {
+		t.Parent[f] = FaceEdge{-1, -1}
+		t.Edge[f] = -1
+	}
+	seen := make([]bool, len(m.Faces))
+	seen[root] = true
+	t.Order = []int{root}
+	for i := 0; i < len(t.Order); i++ {
+		f := t.Order[i]
+		sort.Slice(kept[f], func(i, j int) bool { return kept[f][i].a.K < kept[f][j].a.K })
+		for _, h := range kept[f] {
+			if seen[h.b.Face] {
+				continue
+			}
+			seen[h.b.Face] = true
+			t.Parent[h.b.Face] = h.a
+			t.Edge[h.b.Face] = h.b.K
+			t.Order = append(t.Order, h.b.Face)
+		}
+	}
+	if len(t.Order) != len(m.Faces) {
+		return nil, errors.New("the mesh is in more than one piece")
+	}
+	return t, nil
+}
+
+// Layout returns the corners of each face, CCW, when the mesh is
+// unfolded along the tree, with the root face as Flatten leaves it.
+func (m *Mesh) Layout(t *Tree) [][]*Point2D {
+	polys := make([][]*Point2D, len(m.Faces))
+	for _, f := range t.Order {
+		pts := m.Flatten(f)
+		polys[f] = pts
+		p := t.Parent[f]
+		if p.Face < 0 {
+			continue
+		}
+		// move edge k onto the parent's edge, the other way round
+		a, b := polys[p.Face][m.Next(p.Face, p.K)], polys[p.Face][p.K]
+		k := t.Edge[f]
+		c, d := pts[k], pts[m.Next(f, k)]
+		rad := math.Atan2(b.Y-a.Y, b.X-a.X) - math.Atan2(d.Y-c.Y, d.X-c.X)
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		for i, q := range pts {
+			x, y := q.X-c.X, q.Y-c.Y
+			pts[i] = &Point2D{a.X + x*cos - y*sin, a.Y + x*sin + y*cos}
+		}
+	}
+	return polys
+}
+
+// countOverlaps returns the number of pairs of the polygons that
+// overlap, scaled by s so that geom.Epsilon is in proportion, counting
+// no further than limit unless limit is negative.
+func countOverlaps(polys [][]*Point2D, s float64, limit int) int {
+	type box struct {
+		poly                   []*Point2D
+		minX, minY, maxX, maxY float64
+	}
+	boxes := make([]box, len(polys))
+	for i, poly := range polys {
+		scaled := make([]*Point2D, len(poly))
+		b := box{minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+		for j, p := range poly {
+			q := &Point2D{p.X * s, p.Y * s}
+			scaled[j] = q
+			b.minX, b.minY = math.Min(b.minX, q.X), math.Min(b.minY, q.Y)
+			b.maxX, b.maxY = math.Max(b.maxX, q.X), math.Max(b.maxY, q.Y)
+		}
+		b.poly = scaled
+		boxes[i] = b
+	}
+	// sweep from left to right, comparing each polygon with those whose
+	// boxes start before it ends
+	sort.Slice(boxes, func(i, j int) bool { return boxes[i].minX < boxes[j].minX })
+	n := 0
+	for i, a := range boxes {
+		for _, b := range boxes[i+1:] {
+			if b.minX >= a.maxX-geom.Epsilon {
+				break
+			}
+			if b.minY < a.maxY-geom.Epsilon && a.minY < b.maxY-geom.Epsilon && geom.Overlap(a.poly, b.poly) {
+				n++
+				if n > limit && limit >= 0 {
+					return n
+				}
+			}
+		}
+	}
+	return n
+}
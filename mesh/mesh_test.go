@@ -0,0 +1,168 @@
+package mesh
+
+import (
+	"../fold"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// A tetrahedron in each format, with its faces written the wrong way
+// round, so that Orient has something to do.
+const (
+	tetraOBJ = `# a tetrahedron
+o tetra
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 0 0 1
+vt 0 0
+vn 0 0 1
+f 1 2 3
+f 1/1 2/1 4/1
+f 1//1 3//1 4//1
+f -3 -2 -1
+`
+	tetraOFF = `OFF # a tetrahedron
+4 4 6
+0 0 0
+1 0 0
+0 1 0
+
+0 0 1
+3 0 1 2
+3 0 1 3 # comment
+3 0 2 3
+3 1 2 3
+`
+)
+
+var tetraFaces = [][3]int{{0, 1, 2}, {0, 1, 3}, {0, 2, 3}, {1, 2, 3}}
+
+var tetraVertices = [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+func tetraSTL() string {
+	s := "solid tetra\n"
+	for _, f := range tetraFaces {
+		s += "facet normal 0 0 0\nouter loop\n"
+		for _, i := range f {
+			v := tetraVertices[i]
+			s += fmt.Sprintf("vertex %g %g %g\n", v[0], v[1], v[2])
+		}
+		s += "endloop\nendfacet\n"
+	}
+	return s + "endsolid tetra\n"
+}
+
+func tetraBinarySTL() []byte {
+	return binarySTL(tetraFaces, tetraVertices)
+}
+
+func binarySTL(faces [][3]int, vertices [][3]float32) []byte {
+	data := make([]byte, 84+50*len(faces))
+	copy(data, "binary STL")
+	binary.LittleEndian.PutUint32(data[80:], uint32(len(faces)))
+	for t, f := range faces {
+		for k, i := range f {
+			for j, c := range vertices[i] {
+				binary.LittleEndian.PutUint32(data[84+50*t+12+12*k+4*j:], math.Float32bits(c))
+			}
+		}
+	}
+	return data
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"tetra.obj", tetraOBJ},
+		{"TETRA.OFF", tetraOFF},
+		{"tetra.stl", tetraSTL()},
+		{"binary.stl", string(tetraBinarySTL())},
+	} {
+		m, err := Read(tt.name, []byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(m.Vertices) != 4 || len(m.Faces) != 4 {
+			t.Errorf("%s: %d vertices and %d faces, want 4 and 4", tt.name, len(m.Vertices), len(m.Faces))
+			continue
+		}
+		for i, v := range tetraVertices {
+			if p := m.Vertices[i]; p.X != float64(v[0]) || p.Y != float64(v[1]) || p.Z != float64(v[2]) {
+				t.Errorf("%s: vertex %d is %v", tt.name, i, p)
+			}
+		}
+		for f, face := range tetraFaces {
+			if fmt.Sprint(m.Faces[f]) != fmt.Sprint(face[:]) {
+				t.Errorf("%s: face %d is %v, want %v", tt.name, f, m.Faces[f], face)
+			}
+		}
+		if err := m.Orient(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else if v := fold.Volume(m.Vertices, m.Faces); math.Abs(v-1.0/6) > 1e-9 {
+			t.Errorf("%s: volume %g after Orient, want 1/6", tt.name, v)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, data string
+		err        string // start of the error
+	}{
+		{"tetra.ply", tetraOBJ, "tetra.ply: not an OBJ"},
+		{"a.obj", "v 0 0\n", "a.obj: line 1: vertex needs three coordinates"},
+		{"a.obj", "v 0 0 x\n", "a.obj: line 1: bad coordinate"},
+		{"a.obj", "v 0 0 0\nf 1 2 0\n", "a.obj: line 2: bad vertex"},
+		{"a.obj", "v 0 0 0\nf 1 2 3\n", "a.obj: line 2: no vertex 2"},
+		{"a.obj", "v 0 0 0\nv 1 0 0\nf 1 2 2\n", "a.obj: no faces"}, // degenerate
+		{"a.off", "4 4 6\n", "a.off: missing OFF header"},
+		{"a.off", "OFF\n4\n", "a.off: line 2: missing counts"},
+		{"a.off", "OFF\n1 1 0\n0 0 0\n3 0 0\n", "a.off: line 4: bad face"},
+		{"a.stl", "facet normal 0 0 0\n", "a.stl: not an STL file"},
+		{"a.stl", "solid a\nvertex 0 0\n", "a.stl: line 2: vertex needs three coordinates"},
+		{"a.obj", "v 0 0 0\nv 1 0 0\nv 2 0 0\nf 1 2 3\n", "a.obj: line 4: face has no area"},
+		{"a.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 1 3\n", "a.obj: line 4: face has no area"},
+		{"a.off", "OFF 3 1 0\n0 0 0\n1 1 1\n2 2 2\n3 0 1 2\n", "a.off: line 5: face has no area"},
+		{"a.stl", strings.Replace(tetraSTL(), "vertex 0 1 0", "vertex 0.5 0 0", 1), "a.stl: line 7: face has no area"},
+		{"a.stl", string(binarySTL([][3]int{{0, 1, 2}, {0, 1, 3}}, [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {2, 0, 0}})),
+			"a.stl: triangle 2: face has no area"},
+		{"a.stl", string(binarySTL([][3]int{{0, 1, 2}}, [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, float32(math.NaN()), 0}})),
+			"a.stl: triangle 1: bad coordinate NaN"},
+	} {
+		_, err := Read(tt.name, []byte(tt.data))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("Read(%q, %q) = %v, want %s...", tt.name, tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	m, err := ReadOFF(strings.NewReader(tetraOFF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nbrs, err := m.Neighbors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, face := range m.Faces {
+		for k, n := range nbrs[f] {
+			u, v := face[k], face[m.Next(f, k)]
+			u1, v1 := m.Faces[n.Face][n.K], m.Faces[n.Face][m.Next(n.Face, n.K)]
+			if n.Face == f || !(u == u1 && v == v1 || u == v1 && v == u1) {
+				t.Errorf("edge %d of face %d is next to edge %d of face %d", k, f, n.K, n.Face)
+			}
+		}
+	}
+	m.Faces = append(m.Faces, []int{0, 1, 3})
+	if _, err := m.Neighbors(); err == nil {
+		t.Error("no error for three faces at an edge")
+	}
+}
@@ -0,0 +1,643 @@
+package polyhedra
+
+import (
+	"../fold"
+	"../mesh"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* A catalog of polyhedra with regular faces, for making nets of them.
+
+   Each solid is given by the coordinates of its corners, and its faces
+   are found as the convex hull of the corners.  The Platonic and
+   Archimedean solids have the coordinates found in the usual references
+   (all permutations, or even permutations, of a few points, with all
+   combinations of signs); prisms, antiprisms and the Johnson solids
+   made from pyramids, cupolas, prisms and antiprisms are stacks of
+   regular polygons, one above the other, with unit edges.
+*/
+
+var phi = (1 + math.Sqrt(5)) / 2
+
+// perms returns the points with the coordinates of p permuted, by even
+// permutations only if even is true, and with each coordinate that
+// isn't zero positive and negative.  If parity is 1 or -1, only points
+// with an even number of minus signs are kept for even permutations and
+// an odd number for odd permutations, or the other way round for -1.
+func perms(p [3]float64, even bool, parity int) []fold.Point3D {
+	orders := [][4]int{{0, 1, 2, 0}, {1, 2, 0, 0}, {2, 0, 1, 0}, {0, 2, 1, 1}, {2, 1, 0, 1}, {1, 0, 2, 1}}
+	var pts []fold.Point3D
+	seen := make(map[fold.Point3D]bool)
+	for _, o := range orders {
+		odd := o[3]
+		if even && odd == 1 {
+			continue
+		}
+		for signs := 0; signs < 8; signs++ {
+			var c [3]float64
+			minus := 0
+			for i := 0; i < 3; i++ {
+				c[i] = p[o[i]]
+				if signs&(1<<uint(i)) != 0 {
+					if c[i] == 0 {
+						c[i] = math.NaN() // same point as with +0
+					}
+					c[i] = -c[i]
+					minus++
+				}
+			}
+			if math.IsNaN(c[0] + c[1] + c[2]) {
+				continue
+			}
+			if parity != 0 && (minus+odd)%2 != (1-parity)/2 {
+				continue
+			}
+			q := fold.Point3D{c[0], c[1], c[2]}
+			if !seen[q] {
+				seen[q] = true
+				pts = append(pts, q)
+			}
+		}
+	}
+	return pts
+}
+
+func all(ps ...[3]float64) []fold.Point3D {
+	var pts []fold.Point3D
+	for _, p := range ps {
+		pts = append(pts, perms(p, false, 0)...)
+	}
+	return pts
+}
+
+func even(ps ...[3]float64) []fold.Point3D {
+	var pts []fold.Point3D
+	for _, p := range ps {
+		pts = append(pts, perms(p, true, 0)...)
+	}
+	return pts
+}
+
+// tribonacci constant, for the snub cube
+var tribonacci = (1 + math.Cbrt(19+3*math.Sqrt(33)) + math.Cbrt(19-3*math.Sqrt(33))) / 3
+
+func snubCube() []fold.Point3D {
+	t := tribonacci
+	return perms([3]float64{1, 1 / t, t}, false, 1)
+}
+
+func snubDodecahedron() []fold.Point3D {
+	// ξ is the real root of ξ³ - 2ξ = φ
+	xi := 1.0
+	for i := 0; i < 100; i++ {
+		xi -= (xi*xi*xi - 2*xi - phi) / (3*xi*xi - 2)
+	}
+	a := xi - 1/xi
+	b := xi*phi + phi*phi + phi/xi
+	var pts []fold.Point3D
+	for _, p := range [][3]float64{
+		{2 * a, 2, 2 * b},
+		{a + b/phi + phi, -a*phi + b + 1/phi, a/phi + b*phi - 1},
+		{-a/phi + b*phi + 1, -a + b/phi - phi, a*phi + b - 1/phi},
+		{-a/phi + b*phi - 1, a - b/phi - phi, a*phi + b + 1/phi},
+		{a + b/phi - phi, a*phi - b + 1/phi, a/phi + b*phi + 1},
+	} {
+		// even permutations with an even number of minus signs
+		pts = append(pts, perms(p, true, 1)...)
+	}
+	return pts
+}
+
+// A ring is a regular polygon with unit sides, or a single point if n is
+// 1, lying flat and centred on the Z axis, with its first corner at the
+// given angle.
+type ring struct {
+	n     int
+	angle float64
+}
+
+func (r ring) radius() float64 {
+	if r.n == 1 {
+		return 0
+	}
+	return 1 / (2 * math.Sin(math.Pi/float64(r.n)))
+}
+
+func (r ring) corners(z float64) []fold.Point3D {
+	pts := make([]fold.Point3D, r.n)
+	for i := range pts {
+		a := r.angle + 2*math.Pi*float64(i)/float64(r.n)
+		pts[i] = fold.Point3D{r.radius() * math.Cos(a), r.radius() * math.Sin(a), z}
+	}
+	return pts
+}
+
+// stack returns the corners of rings stacked from the bottom up, each as
+// far above the one below as makes the edges between them unit length.
+func stack(rings ...ring) []fold.Point3D {
+	var pts []fold.Point3D
+	z := 0.0
+	var below []fold.Point3D
+	for _, r := range rings {
+		above := r.corners(z)
+		if below != nil {
+			// the nearest corners are joined by an edge
+			d := math.Inf(1)
+			for _, p := range below {
+				for _, q := range r.corners(0) {
+					d = math.Min(d, math.Hypot(p.X-q.X, p.Y-q.Y))
+				}
+			}
+			z += math.Sqrt(1 - d*d)
+			above = r.corners(z)
+		}
+		pts = append(pts, above...)
+		below = above
+	}
+	return pts
+}
+
+// the rings of a cupola with n sides on top
+func cupola(n int, angle float64) []ring {
+	return []ring{{2 * n, angle}, {n, angle - math.Pi/float64(2*n)}}
+}
+
+var solids = map[string]func() []fold.Point3D{
+	// Platonic solids
+	"tetrahedron":  func() []fold.Point3D { return perms([3]float64{1, 1, 1}, true, 1) },
+	"cube":         func() []fold.Point3D { return all([3]float64{1, 1, 1}) },
+	"octahedron":   func() []fold.Point3D { return all([3]float64{1, 0, 0}) },
+	"dodecahedron": func() []fold.Point3D { return append(all([3]float64{1, 1, 1}), even([3]float64{0, 1 / phi, phi})...) },
+	"icosahedron":  func() []fold.Point3D { return even([3]float64{0, 1, phi}) },
+
+	// Archimedean solids
+	"truncated-tetrahedron": func() []fold.Point3D { return perms([3]float64{3, 1, 1}, true, 1) },
+	"cuboctahedron":         func() []fold.Point3D { return all([3]float64{1, 1, 0}) },
+	"truncated-cube":        func() []fold.Point3D { return all([3]float64{math.Sqrt2 - 1, 1, 1}) },
+	"truncated-octahedron":  func() []fold.Point3D { return all([3]float64{0, 1, 2}) },
+	"rhombicuboctahedron":   func() []fold.Point3D { return all([3]float64{1, 1, 1 + math.Sqrt2}) },
+	"truncated-cuboctahedron": func() []fold.Point3D {
+		return all([3]float64{1, 1 + math.Sqrt2, 1 + 2*math.Sqrt2})
+	},
+	"snub-cube": snubCube,
+	"icosidodecahedron": func() []fold.Point3D {
+		return even([3]float64{0, 0, phi}, [3]float64{0.5, phi / 2, phi * phi / 2})
+	},
+	"truncated-dodecahedron": func() []fold.Point3D {
+		return even([3]float64{0, 1 / phi, 2 + phi}, [3]float64{1 / phi, phi, 2 * phi}, [3]float64{phi, 2, phi + 1})
+	},
+	"truncated-icosahedron": func() []fold.Point3D {
+		return even([3]float64{0, 1, 3 * phi}, [3]float64{1, 2 + phi, 2 * phi}, [3]float64{phi, 2, phi * phi * phi})
+	},
+	"rhombicosidodecahedron": func() []fold.Point3D {
+		return even([3]float64{1, 1, phi * phi * phi}, [3]float64{phi * phi, phi, 2 * phi}, [3]float64{2 + phi, 0, phi * phi})
+	},
+	"truncated-icosidodecahedron": func() []fold.Point3D {
+		return even([3]float64{1 / phi, 1 / phi, 3 + phi}, [3]float64{2 / phi, phi, 1 + 2*phi},
+			[3]float64{1 / phi, phi * phi, 3*phi - 1}, [3]float64{2*phi - 1, 2, 2 + phi}, [3]float64{phi, 3, 2 * phi})
+	},
+	"snub-dodecahedron": snubDodecahedron,
+
+	// Johnson solids made of rings
+	"square-pyramid":                   func() []fold.Point3D { return stack(ring{4, 0}, ring{1, 0}) },
+	"pentagonal-pyramid":               func() []fold.Point3D { return stack(ring{5, 0}, ring{1, 0}) },
+	"triangular-cupola":                func() []fold.Point3D { return stack(cupola(3, 0)...) },
+	"square-cupola":                    func() []fold.Point3D { return stack(cupola(4, 0)...) },
+	"pentagonal-cupola":                func() []fold.Point3D { return stack(cupola(5, 0)...) },
+	"elongated-triangular-pyramid":     func() []fold.Point3D { return stack(ring{3, 0}, ring{3, 0}, ring{1, 0}) },
+	"elongated-square-pyramid":         func() []fold.Point3D { return stack(ring{4, 0}, ring{4, 0}, ring{1, 0}) },
+	"elongated-pentagonal-pyramid":     func() []fold.Point3D { return stack(ring{5, 0}, ring{5, 0}, ring{1, 0}) },
+	"gyroelongated-square-pyramid":     func() []fold.Point3D { return stack(ring{4, 0}, ring{4, math.Pi / 4}, ring{1, 0}) },
+	"gyroelongated-pentagonal-pyramid": func() []fold.Point3D { return stack(ring{5, 0}, ring{5, math.Pi / 5}, ring{1, 0}) },
+	"triangular-bipyramid":             func() []fold.Point3D { return stack(ring{1, 0}, ring{3, 0}, ring{1, 0}) },
+	"pentagonal-bipyramid":             func() []fold.Point3D { return stack(ring{1, 0}, ring{5, 0}, ring{1, 0}) },
+	"elongated-triangular-bipyramid":   func() []fold.Point3D { return stack(ring{1, 0}, ring{3, 0}, ring{3, 0}, ring{1, 0}) },
+	"elongated-square-bipyramid":       func() []fold.Point3D { return stack(ring{1, 0}, ring{4, 0}, ring{4, 0}, ring{1, 0}) },
+	"elongated-pentagonal-bipyramid":   func() []fold.Point3D { return stack(ring{1, 0}, ring{5, 0}, ring{5, 0}, ring{1, 0}) },
+	"gyroelongated-square-bipyramid": func() []fold.Point3D {
+		return stack(ring{1, 0}, ring{4, 0}, ring{4, math.Pi / 4}, ring{1, 0})
+	},
+	"elongated-triangular-cupola": func() []fold.Point3D { return stack(append([]ring{{6, 0}}, cupola(3, 0)...)...) },
+	"elongated-square-cupola":     func() []fold.Point3D { return stack(append([]ring{{8, 0}}, cupola(4, 0)...)...) },
+	"elongated-pentagonal-cupola": func() []fold.Point3D { return stack(append([]ring{{10, 0}}, cupola(5, 0)...)...) },
+	"gyroelongated-triangular-cupola": func() []fold.Point3D {
+		return stack(append([]ring{{6, 0}}, cupola(3, math.Pi/6)...)...)
+	},
+	"gyroelongated-square-cupola": func() []fold.Point3D {
+		return stack(append([]ring{{8, 0}}, cupola(4, math.Pi/8)...)...)
+	},
+	"gyroelongated-pentagonal-cupola": func() []fold.Point3D {
+		return stack(append([]ring{{10, 0}}, cupola(5, math.Pi/10)...)...)
+	},
+}
+
+// MaxSides is the most sides that the ends of a prism or antiprism can
+// have.
+var MaxSides = 40
+
+// Names returns the names of the solids in the catalog, other than
+// prisms and antiprisms, which are prism-N and antiprism-N for N sides.
+func Names() []string {
+	var names []string
+	for name := range solids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Solid returns the solid of the given name, or given in Conway's
+// notation.
+func Solid(name string) (*mesh.Mesh, error) {
+	if f := solids[name]; f != nil {
+		return Hull(f()), nil
+	}
+	for _, kind := range []string{"prism-", "antiprism-"} {
+		if !strings.HasPrefix(name, kind) {
+			continue
+		}
+		n, err := strconv.Atoi(name[len(kind):])
+		if err != nil || n < 3 || n > MaxSides {
+			return nil, fmt.Errorf("%s: a %s needs 3 to %d sides", name, kind[:len(kind)-1], MaxSides)
+		}
+		angle := 0.0
+		if kind == "antiprism-" {
+			angle = math.Pi / float64(n)
+		}
+		return Hull(stack(ring{n, 0}, ring{n, angle})), nil
+	}
+	if isConway(name) {
+		return Conway(name)
+	}
+	return nil, fmt.Errorf("No solid %s; try %s, prism-N, antiprism-N, or Conway's notation", name, strings.Join(Names(), ", "))
+}
+
+// Hull returns the convex hull of points that are all its corners, with
+// the faces CCW seen from outside.
+func Hull(pts []fold.Point3D) *mesh.Mesh {
+	m := &mesh.Mesh{Vertices: pts}
+	size := 0.0
+	for _, p := range pts {
+		size = math.Max(size, p.Length())
+	}
+	eps := 1e-6 * size
+	seen := make(map[string]bool)
+	for i := range pts {
+		for j := i + 1; j < len(pts); j++ {
+			for k := j + 1; k < len(pts); k++ {
+				n := pts[j].Sub(pts[i]).Cross(pts[k].Sub(pts[i]))
+				if n.Length() < eps*eps {
+					continue // in a line
+				}
+				n = n.Scale(1 / n.Length())
+				// a face if every point is on the same side of the plane
+				above, below := false, false
+				var face []int
+				for l, p := range pts {
+					d := n.Dot(p.Sub(pts[i]))
+					switch {
+					case d > eps:
+						above = true
+					case d < -eps:
+						below = true
+					default:
+						face = append(face, l)
+					}
+					if above && below {
+						break
+					}
+				}
+				if above && below {
+					continue
+				}
+				key := fmt.Sprint(face)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if above {
+					n = n.Scale(-1)
+				}
+				m.Faces = append(m.Faces, ccw(pts, face, n))
+			}
+		}
+	}
+	return m
+}
+
+// ccw sorts the corners of a face CCW around its centre, seen from the
+// side that n points to.
+func ccw(pts []fold.Point3D, face []int, n fold.Point3D) []int {
+	c := fold.Centroid(pts, face)
+	u := pts[face[0]].Sub(c)
+	w := n.Cross(u)
+	angle := make(map[int]float64)
+	for _, i := range face {
+		d := pts[i].Sub(c)
+		angle[i] = math.Atan2(d.Dot(w), d.Dot(u))
+	}
+	sort.Slice(face, func(a, b int) bool { return angle[face[a]] < angle[face[b]] })
+	return face
+}
+
+/* Conway's notation for polyhedra.
+
+   A polyhedron is a seed, T, C, O, D or I for the Platonic solids, or
+   Pn, An or Yn for the prism, antiprism or pyramid with n sides,
+   preceded by operators that are applied from right to left, so tI is
+   the truncated icosahedron and dtI its dual.  The operators are
+
+	d  dual         faces become corners and corners faces
+	a  ambo         corners cut off down to the middles of the edges
+	k  kis          a pyramid on every face
+	g  gyro         every face split into pentagons, in a pinwheel
+	t  truncate     dkd
+	j  join         da
+	e  expand       aa
+	o  ortho        daa
+	s  snub         dgd
+	b  bevel        dkda
+	n  needle       kd
+	z  zip          dk
+	m  meta         kda
+
+   The operators only say how faces and corners are connected.  The
+   shape comes from canonicalization (after George Hart): the corners
+   are moved until every face is flat and every edge touches the unit
+   sphere, which gives the familiar shapes when they exist.
+*/
+
+var operators = map[byte]string{
+	't': "dkd", 'j': "da", 'e': "aa", 'o': "daa", 's': "dgd", 'b': "dkda",
+	'n': "kd", 'z': "dk", 'm': "kda",
+}
+
+var basic = map[byte]func(*mesh.Mesh) *mesh.Mesh{'d': dual, 'a': ambo, 'k': kis, 'g': gyro}
+
+// MaxFaces is the most faces a polyhedron in Conway's notation can have,
+// since canonicalization takes time in proportion to the number of faces.
+var MaxFaces = 2000
+
+var seeds = map[byte]string{'T': "tetrahedron", 'C': "cube", 'O': "octahedron", 'D': "dodecahedron", 'I': "icosahedron"}
+
+// Conway returns the polyhedron given in Conway's notation.
+func Conway(notation string) (*mesh.Mesh, error) {
+	i := strings.IndexAny(notation, "TCODIPAY")
+	if i < 0 {
+		return nil, fmt.Errorf("%s: no seed", notation)
+	}
+	var m *mesh.Mesh
+	seed := notation[i:]
+	if name := seeds[seed[0]]; name != "" && len(seed) == 1 {
+		m = Hull(solids[name]())
+	} else {
+		n, err := strconv.Atoi(seed[1:])
+		if err != nil || n < 3 || n > MaxSides {
+			return nil, fmt.Errorf("%s: seed %s needs 3 to %d sides", notation, seed[:1], MaxSides)
+		}
+		switch seed[0] {
+		case 'P':
+			m = Hull(stack(ring{n, 0}, ring{n, 0}))
+		case 'A':
+			m = Hull(stack(ring{n, 0}, ring{n, math.Pi / float64(n)}))
+		case 'Y':
+			m = Hull(append(ring{n, 0}.corners(0), fold.Point3D{0, 0, 1}))
+		default:
+			return nil, fmt.Errorf("%s: unknown seed %s", notation, seed)
+		}
+	}
+	if err := m.Orient(); err != nil {
+		return nil, err
+	}
+	for j := i - 1; j >= 0; j-- {
+		ops := operators[notation[j]]
+		if ops == "" {
+			ops = notation[j : j+1]
+		}
+		for k := len(ops) - 1; k >= 0; k-- {
+			op := basic[ops[k]]
+			if op == nil {
+				return nil, fmt.Errorf("%s: unknown operator %c", notation, notation[j])
+			}
+			m = op(m)
+			if len(m.Faces) > MaxFaces {
+				return nil, fmt.Errorf("%s: more than %d faces", notation, MaxFaces)
+			}
+			if err := m.Orient(); err != nil {
+				return nil, fmt.Errorf("%s: %s", notation, err)
+			}
+		}
+	}
+	canonicalize(m)
+	return m, nil
+}
+
+// isConway reports whether name looks like Conway's notation rather than
+// a name from the catalog: operators, then an upper case seed.
+func isConway(name string) bool {
+	i := strings.IndexAny(name, "TCODIPAY")
+	if i < 0 {
+		return false
+	}
+	for _, c := range name[:i] {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// around returns, for each vertex, the edges leaving it in order around
+// it, as the faces they belong to and the index of the edge in the face.
+func around(m *mesh.Mesh) [][]mesh.FaceEdge {
+	out := make(map[[2]int]mesh.FaceEdge) // directed edge to the face it belongs to
+	first := make([]mesh.FaceEdge, len(m.Vertices))
+	for i := range first {
+		first[i] = mesh.FaceEdge{-1, -1}
+	}
+	for f, face := range m.Faces {
+		for k, u := range face {
+			out[[2]int{u, face[m.Next(f, k)]}] = mesh.FaceEdge{f, k}
+			first[u] = mesh.FaceEdge{f, k}
+		}
+	}
+	ring := make([][]mesh.FaceEdge, len(m.Vertices))
+	for v, e := range first {
+		for e.Face >= 0 {
+			ring[v] = append(ring[v], e)
+			// the face on the other side of the edge, and its edge out of v
+			w := m.Faces[e.Face][m.Next(e.Face, e.K)]
+			back, ok := out[[2]int{w, v}]
+			if !ok {
+				break // boundary
+			}
+			e = mesh.FaceEdge{back.Face, m.Next(back.Face, back.K)}
+			if e == first[v] {
+				break
+			}
+		}
+	}
+	return ring
+}
+
+// dual has a corner at the centre of each face, and a face around each
+// corner.
+func dual(m *mesh.Mesh) *mesh.Mesh {
+	d := new(mesh.Mesh)
+	for _, face := range m.Faces {
+		d.Vertices = append(d.Vertices, fold.Centroid(m.Vertices, face))
+	}
+	for _, ring := range around(m) {
+		var face []int
+		for _, e := range ring {
+			face = append(face, e.Face)
+		}
+		d.Faces = append(d.Faces, face)
+	}
+	return d
+}
+
+// ambo has a corner at the middle of each edge, and a face for each face
+// and each corner.
+func ambo(m *mesh.Mesh) *mesh.Mesh {
+	a := new(mesh.Mesh)
+	mid := make(map[[2]int]int)
+	middle := func(u, v int) int {
+		if u > v {
+			u, v = v, u
+		}
+		if i, ok := mid[[2]int{u, v}]; ok {
+			return i
+		}
+		mid[[2]int{u, v}] = len(a.Vertices)
+		p, q := m.Vertices[u], m.Vertices[v]
+		a.Vertices = append(a.Vertices, p.Add(q).Scale(0.5))
+		return mid[[2]int{u, v}]
+	}
+	for f, face := range m.Faces {
+		var af []int
+		for k, u := range face {
+			af = append(af, middle(u, face[m.Next(f, k)]))
+		}
+		a.Faces = append(a.Faces, af)
+	}
+	for v, ring := range around(m) {
+		var af []int
+		for _, e := range ring {
+			af = append(af, middle(v, m.Faces[e.Face][m.Next(e.Face, e.K)]))
+		}
+		a.Faces = append(a.Faces, af)
+	}
+	return a
+}
+
+// kis raises a pyramid on every face.
+func kis(m *mesh.Mesh) *mesh.Mesh {
+	k := &mesh.Mesh{Vertices: append([]fold.Point3D(nil), m.Vertices...)}
+	size := m.EdgeLength()
+	for f, face := range m.Faces {
+		apex := len(k.Vertices)
+		c, n := fold.Centroid(m.Vertices, face), fold.Normal(m.Vertices, face)
+		k.Vertices = append(k.Vertices, c.Add(n.Scale(size/10)))
+		for i, u := range face {
+			k.Faces = append(k.Faces, []int{u, face[m.Next(f, i)], apex})
+		}
+	}
+	return k
+}
+
+// gyro splits every face into pentagons, one for each corner, each with
+// a corner at the centre of the face, the corner of the face, and two
+// corners on each of the edges.
+func gyro(m *mesh.Mesh) *mesh.Mesh {
+	g := &mesh.Mesh{Vertices: append([]fold.Point3D(nil), m.Vertices...)}
+	third := make(map[[2]int]int) // the point a third of the way from u to v
+	point := func(u, v int) int {
+		if i, ok := third[[2]int{u, v}]; ok {
+			return i
+		}
+		third[[2]int{u, v}] = len(g.Vertices)
+		p, q := m.Vertices[u], m.Vertices[v]
+		g.Vertices = append(g.Vertices, p.Add(q.Sub(p).Scale(1.0/3)))
+		return third[[2]int{u, v}]
+	}
+	for f, face := range m.Faces {
+		c := len(g.Vertices)
+		g.Vertices = append(g.Vertices, fold.Centroid(m.Vertices, face))
+		for k, v1 := range face {
+			v2 := face[m.Next(f, k)]
+			v3 := face[m.Next(f, m.Next(f, k))]
+			g.Faces = append(g.Faces, []int{c, point(v1, v2), point(v2, v1), v2, point(v2, v3)})
+		}
+	}
+	return g
+}
+
+// canonicalize moves the corners until the faces are flat and the edges
+// touch the unit sphere, with the points where they touch centred on the
+// origin.
+func canonicalize(m *mesh.Mesh) {
+	var edges [][2]int
+	for f, face := range m.Faces {
+		for k, u := range face {
+			if v := face[m.Next(f, k)]; u < v {
+				edges = append(edges, [2]int{u, v})
+			}
+		}
+	}
+	// tangent returns the point of the line through p and q nearest the origin
+	tangent := func(p, q fold.Point3D) fold.Point3D {
+		d := q.Sub(p)
+		return p.Sub(d.Scale(d.Dot(p) / d.Dot(d)))
+	}
+	// start at about the right size
+	r := 0.0
+	for _, e := range edges {
+		r += tangent(m.Vertices[e[0]], m.Vertices[e[1]]).Length()
+	}
+	for i, p := range m.Vertices {
+		m.Vertices[i] = p.Scale(float64(len(edges)) / r)
+	}
+	const rate = 0.2 // of the way to the target each step, for stability
+	for step := 0; step < 5000; step++ {
+		vs := append([]fold.Point3D(nil), m.Vertices...)
+		for _, e := range edges {
+			t := tangent(vs[e[0]], vs[e[1]])
+			c := t.Scale(rate * (1 - t.Length()) / 2)
+			for _, i := range e {
+				vs[i] = vs[i].Add(c)
+			}
+		}
+		var centre fold.Point3D
+		for _, e := range edges {
+			t := tangent(vs[e[0]], vs[e[1]])
+			centre = centre.Add(t)
+		}
+		centre = centre.Scale(1 / float64(len(edges)))
+		for i := range vs {
+			vs[i] = vs[i].Sub(centre)
+		}
+		moved := append([]fold.Point3D(nil), vs...)
+		old := m.Vertices
+		m.Vertices = vs
+		for _, face := range m.Faces {
+			c, n := fold.Centroid(m.Vertices, face), fold.Normal(m.Vertices, face)
+			for _, i := range face {
+				d := n.Scale(rate * n.Dot(c.Sub(vs[i])))
+				moved[i] = moved[i].Add(d)
+			}
+		}
+		m.Vertices = moved
+		change := 0.0
+		for i := range old {
+			change = math.Max(change, moved[i].Sub(old[i]).Length())
+		}
+		if change < 1e-12 {
+			break
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package polyhedra
+
+import (
+	"../mesh"
+	"math"
+	"strings"
+	"testing"
+)
+
+// faceCounts returns the number of faces with each number of sides.
+func faceCounts(m *mesh.Mesh) map[int]int {
+	counts := make(map[int]int)
+	for _, f := range m.Faces {
+		counts[len(f)]++
+	}
+	return counts
+}
+
+// The solids in the catalog are closed, with regular faces and all of
+// their edges the same length.
+func TestCatalog(t *testing.T) {
+	for _, name := range append(Names(), "prism-3", "antiprism-40") {
+		m, err := Solid(name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		nbrs, err := m.Neighbors()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		unit := m.Vertices[m.Faces[0][1]].Sub(m.Vertices[m.Faces[0][0]]).Length()
+		edges := 0
+		for f, face := range m.Faces {
+			for k, i := range face {
+				if nbrs[f][k].Face < 0 {
+					t.Errorf("%s: face %d is open at edge %d", name, f, k)
+				}
+				edges++
+				d := m.Vertices[face[m.Next(f, k)]].Sub(m.Vertices[i]).Length() / unit
+				if math.Abs(d-1) > 1e-9 {
+					t.Errorf("%s: edges of lengths 1 and %g", name, d)
+				}
+				// a face is regular if it also has equal diagonals
+				c := m.Vertices[face[(k+2)%len(face)]]
+				d = c.Sub(m.Vertices[i]).Length() / unit
+				if want := 2 * math.Sin(math.Pi*float64(len(face)-2)/float64(2*len(face))); math.Abs(d-want) > 1e-9 {
+					t.Errorf("%s: %d-gon with a diagonal of %g, want %g", name, len(face), d, want)
+				}
+			}
+		}
+		if v, e, f := len(m.Vertices), edges/2, len(m.Faces); v-e+f != 2 {
+			t.Errorf("%s: %d vertices, %d edges and %d faces", name, v, e, f)
+		}
+	}
+}
+
+func TestSolids(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		faces map[int]int
+	}{
+		{"cube", map[int]int{4: 6}},
+		{"truncated-icosahedron", map[int]int{5: 12, 6: 20}},
+		{"snub-cube", map[int]int{3: 32, 4: 6}},
+		{"prism-7", map[int]int{4: 7, 7: 2}},
+		{"antiprism-5", map[int]int{3: 10, 5: 2}},
+		{"tI", map[int]int{5: 12, 6: 20}},
+		{"aC", map[int]int{3: 8, 4: 6}},
+		{"kD", map[int]int{3: 60}},
+		{"dsD", map[int]int{5: 60}},
+		{"Y5", map[int]int{3: 5, 5: 1}},
+	} {
+		m, err := Solid(tt.name)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		got := faceCounts(m)
+		if len(got) != len(tt.faces) {
+			t.Errorf("%s: faces %v, want %v", tt.name, got, tt.faces)
+			continue
+		}
+		for n, count := range tt.faces {
+			if got[n] != count {
+				t.Errorf("%s: faces %v, want %v", tt.name, got, tt.faces)
+				break
+			}
+		}
+	}
+}
+
+func TestSolidErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, err string // start of the error
+	}{
+		{"prism-2", "prism-2: a prism needs 3 to 40 sides"},
+		{"antiprism-41", "antiprism-41: "},
+		{"prism-x", "prism-x: a prism needs"},
+		{"P41", "P41: seed P needs 3 to 40 sides"},
+		{"xC", "xC: unknown operator x"},
+		{"C5", "C5: unknown seed C5"},
+		{"dodecahedra", "No solid dodecahedra; try"},
+	} {
+		_, err := Solid(tt.name)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("Solid(%q) = %v, want %s...", tt.name, err, tt.err)
+		}
+	}
+}
@@ -130,6 +130,71 @@ func Ngon(n int, sideLength float64) *Edge {
 	return Polygon(pts)
 }
 
+// polygon drawn by a turtle: starting at the origin heading along the X
+// axis, walk sides[0], turn so that the interior angle is angles[0]
+// (in degrees), walk sides[1], and so on.  There must be one fewer angle
+// than sides, and the polygon is closed by a final side back to the
+// origin.  Returns nil unless the result is a simple polygon in CCW
+// orientation.
+func TurtlePolygon(sides, angles []float64) *Edge {
+	if len(sides) < 2 || len(angles) != len(sides)-1 {
+		return nil
+	}
+	pts := make([]*Point2D, 0, len(sides)+1)
+	p := &Point2D{0, 0}
+	heading := 0.0
+	for i, side := range sides {
+		if side <= 0 {
+			return nil
+		}
+		pts = append(pts, p)
+		y, x := math.Sincos(heading)
+		p = &Point2D{p.X + side*x, p.Y + side*y}
+		if i < len(angles) {
+			heading += math.Pi - angles[i]/180*math.Pi
+		}
+	}
+	if math.Hypot(p.X, p.Y) > 1e-9 { // unless the last side already closes the polygon
+		pts = append(pts, p)
+	}
+	if !simpleCcw(pts) {
+		return nil
+	}
+	return Polygon(pts)
+}
+
+// simpleCcw reports whether pts is a simple polygon in CCW orientation
+func simpleCcw(pts []*Point2D) bool {
+	n := len(pts)
+	if n < 3 {
+		return false
+	}
+	area := 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%n]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	if area <= 0 {
+		return false
+	}
+	cross := func(o, a, b *Point2D) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	for i := 0; i < n; i++ {
+		a, b := pts[i], pts[(i+1)%n]
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n-1 {
+				continue // adjacent sides
+			}
+			c, d := pts[j], pts[(j+1)%n]
+			if cross(a, b, c)*cross(a, b, d) < 0 && cross(c, d, a)*cross(c, d, b) < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func Rect(a, b, c, d *Point2D) *Edge {
 	return Polygon([]*Point2D{a, b, c, d})
 }
@@ -213,6 +278,27 @@ func (e *Edge) Edges() map[int]*Edge {
 	return edgeIndex
 }
 
+// Clone makes a deep copy of the subdivision containing e.  It returns
+// the copy of e and a map from each QuadEdge of the subdivision to its
+// copy, so that other references into the subdivision can be translated.
+func Clone(e *Edge) (*Edge, map[*QuadEdge]*QuadEdge) {
+	edges := e.Edges()
+	copies := make(map[*QuadEdge]*QuadEdge, len(edges))
+	for _, ei := range edges {
+		copies[ei.Q] = new(QuadEdge)
+	}
+	for q, c := range copies {
+		for r := 0; r < 4; r++ {
+			if q[r].Data != nil {
+				c[r].Data = &Point2D{q[r].Data.X, q[r].Data.Y}
+			}
+			next := q[r].Next
+			c[r].Next = &Edge{copies[next.Q], next.R}
+		}
+	}
+	return &Edge{copies[e.Q], e.R}, copies
+}
+
 func (e *Edge) Print() {
 	o := e.Org()
 	d := e.Dest()
@@ -0,0 +1,325 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* Programs for manifold.
+
+   A program is a sequence of commands separated by white space:
+
+	12      attach a polygon with 12 sides
+	f3      a command followed by a count repeats the command, here
+	        moving the cursor forward three times
+	t*      apply a command to the whole perimeter, here adding a tab
+	        to every edge
+	# ...   a comment, up to the end of the line
+	rect(2) a command with arguments, here a rectangle twice as high
+	        as it is wide
+	rect(2)@1
+	        a polygon followed by @k is attached by its kth edge
+	        (counting from 0) instead of its first
+	kite(60,120)~
+	        a polygon followed by ~ is mirrored before it is attached
+
+   Commands other than polygons are single letters unless they have
+   arguments, so white space between them is optional: "ftb" is
+   "f t b", and, since rect is one of the Functions, "ftrect(2)" is
+   "f t rect(2)".  A count or * goes after the arguments, if any:
+   "t(notched)3".  A group of commands in
+   parentheses followed by xN is repeated N times, so a program
+   for a strip of five squares is
+
+	(4 f)x5
+*/
+
+// A Command is a single step of a program.
+type Command struct {
+	Sides int      // number of sides of a polygon, or 0 for other commands
+	Op    string   // the command, if not a polygon
+	Args  []string // arguments in parentheses, if any
+	Count int      // number of repetitions if given, otherwise 0
+	All   bool     // whether the command applies to the whole perimeter
+	Edge  int      // edge of a new polygon to attach by, from @
+	Flip  bool     // whether a new polygon is mirrored, from ~
+}
+
+// String returns the command in the form it is parsed from.
+func (c Command) String() string {
+	var s string
+	if c.Sides != 0 {
+		s = strconv.Itoa(c.Sides)
+	} else {
+		s = c.Op
+	}
+	if c.Args != nil {
+		s += "(" + strings.Join(c.Args, ",") + ")"
+	}
+	if c.Count != 0 {
+		s += strconv.Itoa(c.Count)
+	}
+	if c.All {
+		s += "*"
+	}
+	if c.Edge != 0 {
+		s += "@" + strconv.Itoa(c.Edge)
+	}
+	if c.Flip {
+		s += "~"
+	}
+	return s
+}
+
+// Float returns argument i as a number.
+func (c Command) Float(i int) (float64, error) {
+	if i >= len(c.Args) {
+		return 0, fmt.Errorf("%s: missing argument %d", c.Op, i+1)
+	}
+	f, err := strconv.ParseFloat(c.Args[i], 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s: argument %q is not a number", c.Op, c.Args[i])
+	}
+	return f, nil
+}
+
+// Floats returns all of the arguments as numbers.
+func (c Command) Floats() ([]float64, error) {
+	fs := make([]float64, len(c.Args))
+	for i := range c.Args {
+		f, err := c.Float(i)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+// Times returns the number of times the command is to be done.
+func (c Command) Times() int {
+	if c.Count == 0 {
+		return 1
+	}
+	return c.Count
+}
+
+// Parse parses a program, expanding any repeated groups.
+func Parse(src string) ([]Command, error) {
+	p := &parser{src: src, line: 1}
+	cmds, err := p.sequence()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) { // sequence stops only at the end or at ')'
+		return nil, p.errorf("unexpected ')'")
+	}
+	return cmds, nil
+}
+
+// Limit on the number of commands in an expanded program, so that a
+// mistyped count can't run the server out of memory.
+var MaxCommands = 100000
+
+// Functions holds the names of the commands that take arguments.  The
+// letters before '(' are the longest of these names that they end
+// with, and single-letter commands before it; a name that isn't here
+// takes all of the letters.
+var Functions = make(map[string]bool)
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skip skips white space and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// number parses a decimal number, if there is one, returning 0 if not.
+func (p *parser) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil || n > MaxCommands {
+		return 0, p.errorf("number %s is too big", p.src[start:p.pos])
+	}
+	return n, nil
+}
+
+// args parses a parenthesized list of arguments separated by commas.
+func (p *parser) args() ([]string, error) {
+	p.pos++ // skip '('
+	end := strings.IndexAny(p.src[p.pos:], ")\n(")
+	if end < 0 || p.src[p.pos+end] != ')' {
+		return nil, p.errorf("missing ')' after arguments")
+	}
+	args := strings.Split(p.src[p.pos:p.pos+end], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	if len(args) == 1 && args[0] == "" {
+		args = []string{}
+	}
+	p.pos += end + 1
+	return args, nil
+}
+
+// edge parses an optional @k and ~ after a polygon.
+func (p *parser) edge(cmd *Command) error {
+	if p.pos < len(p.src) && p.src[p.pos] == '@' {
+		p.pos++
+		start := p.pos
+		n, err := p.number()
+		if err != nil {
+			return err
+		}
+		if p.pos == start {
+			return p.errorf("missing edge number after @")
+		}
+		cmd.Edge = n
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '~' {
+		p.pos++
+		cmd.Flip = true
+	}
+	return nil
+}
+
+// sequence parses commands up to the end of the program or a ')'.
+func (p *parser) sequence() ([]Command, error) {
+	var cmds []Command
+	for {
+		p.skip()
+		if p.pos >= len(p.src) || p.src[p.pos] == ')' {
+			return cmds, nil
+		}
+		c := p.src[p.pos]
+		switch {
+		case isDigit(c):
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			cmd := Command{Sides: n}
+			if err := p.edge(&cmd); err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, cmd)
+		case isLetter(c):
+			start := p.pos
+			for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+				p.pos++
+			}
+			name := p.src[start:p.pos]
+			args := p.pos < len(p.src) && p.src[p.pos] == '('
+			op := name[len(name)-1:]
+			if args {
+				op = name
+				for i := range name {
+					if Functions[name[i:]] {
+						op = name[i:]
+						break
+					}
+				}
+			}
+			// each letter before the last command is a command
+			for _, c := range name[:len(name)-len(op)] {
+				cmds = append(cmds, Command{Op: string(c)})
+			}
+			cmd := Command{Op: op}
+			if args {
+				var err error
+				if cmd.Args, err = p.args(); err != nil {
+					return nil, err
+				}
+			}
+			start = p.pos
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos > start && n == 0 {
+				return nil, p.errorf("count must be at least 1")
+			}
+			cmd.Count = n
+			if p.pos < len(p.src) && p.src[p.pos] == '*' {
+				p.pos++
+				cmd.All = true
+			}
+			if args {
+				if err := p.edge(&cmd); err != nil {
+					return nil, err
+				}
+			}
+			cmds = append(cmds, cmd)
+		case c == '(':
+			p.pos++
+			group, err := p.sequence()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("missing ')'")
+			}
+			p.pos++
+			if p.pos >= len(p.src) || p.src[p.pos] != 'x' {
+				return nil, p.errorf("')' must be followed by x and a count")
+			}
+			p.pos++
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return nil, p.errorf("missing count after x")
+			}
+			if len(cmds)+n*len(group) > MaxCommands {
+				return nil, p.errorf("program is too long")
+			}
+			for i := 0; i < n; i++ {
+				cmds = append(cmds, group...)
+			}
+		default:
+			return nil, p.errorf("unexpected %q", c)
+		}
+		if len(cmds) > MaxCommands {
+			return nil, p.errorf("program is too long")
+		}
+	}
+}
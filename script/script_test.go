@@ -0,0 +1,84 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func init() {
+	for _, name := range []string{"rect", "kite", "t", "tabs"} {
+		Functions[name] = true
+	}
+}
+
+var parseTests = []struct {
+	src  string
+	want string // the commands, or "error"
+}{
+	{"", ""},
+	{"12 f3 t*", "12 f3 t*"},
+	{"3f4t", "3 f4 t"},
+	{"ftb", "f t b"},
+	{"(4 f)x3 # comment\n5", "4 f 4 f 4 f 5"},
+	{"((4)x2 f)x2", "4 4 f 4 4 f"},
+	{"rect(2)@1 kite(60, 120)~", "rect(2)@1 kite(60,120)~"},
+	{"ftrect(2)", "f t rect(2)"},
+	{"bttabs(zigzag)", "b t tabs(zigzag)"},
+	{"ft(slot)", "f t(slot)"},
+	{"fq(1)", "fq(1)"},
+	{"t(notched)3", "t(notched)3"},
+	{"t(notched)* 4", "t(notched)* 4"},
+	{"tabs()", "tabs()"},
+	{"(4 f", "error"},
+	{"4)", "error"},
+	{"(4)", "error"},
+	{"(4)x0", "error"},
+	{"f0", "error"},
+	{"t(notched)0", "error"},
+	{"rect(2", "error"},
+	{"4@", "error"},
+	{"!", "error"},
+	{"(4)x100001", "error"},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range parseTests {
+		cmds, err := Parse(tt.src)
+		got := "error"
+		if err == nil {
+			var s []string
+			for _, c := range cmds {
+				s = append(s, c.String())
+			}
+			got = strings.Join(s, " ")
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// Commands are recorded in the history as strings, so each must parse
+// back to itself.
+func TestStringParses(t *testing.T) {
+	for _, tt := range parseTests {
+		cmds, err := Parse(tt.src)
+		if err != nil {
+			continue
+		}
+		for _, c := range cmds {
+			again, err := Parse(c.String())
+			if err != nil || len(again) != 1 || fmt.Sprint(again[0]) != fmt.Sprint(c) {
+				t.Errorf("%q parses as %v, %v", c.String(), again, err)
+			}
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	_, err := Parse("4\n4\n!")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("got %v, want an error on line 3", err)
+	}
+}